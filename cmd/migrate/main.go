@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"snippetbox.glebich/internal/config"
+	"snippetbox.glebich/internal/migrate"
+	"snippetbox.glebich/internal/models"
+	"snippetbox.glebich/migrations"
+)
+
+const usage = `Usage: go run ./cmd/migrate [-config FILE] [-dsn DSN] <command>
+
+Commands:
+  up          apply all pending migrations
+  down [N]    roll back the last N applied migrations (default 1)
+  status      list migrations and whether they are applied
+`
+
+func main() {
+	configFile := flag.String("config", "", "Path to the web server's YAML config file (default CONFIG_FILE)")
+	dsn := flag.String("dsn", "", "Database connection string (postgres://... or sqlite:path/to/file.db), overrides DB_DSN and the config file")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	infoLog := log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "[ERROR]\t", log.Ldate|log.Ltime)
+
+	// DSN берётся так же, как у веб-сервера: -dsn, DB_DSN, файл -config
+	// (или CONFIG_FILE), БД из docker-compose
+	var args []string
+	if *configFile != "" {
+		args = append(args, "-config", *configFile)
+	}
+	if *dsn != "" {
+		args = append(args, "-dsn", *dsn)
+	}
+	cfg, err := config.Load(os.Args[0], args, os.Getenv)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	db, dialect, err := models.OpenDB(cfg.DSN)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.Close()
+
+	migrationFiles, err := migrations.FS(string(dialect))
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	migrator, err := migrate.New(db, string(dialect), migrationFiles)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		done, err := migrator.Up()
+		for _, m := range done {
+			infoLog.Printf("applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if len(done) == 0 {
+			infoLog.Print("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				errorLog.Fatalf("invalid number of steps %q", flag.Arg(1))
+			}
+		}
+		done, err := migrator.Down(steps)
+		for _, m := range done {
+			infoLog.Printf("rolled back %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessLog пишет по записи на каждый обработанный запрос
+type accessLog struct {
+	format  string // combined или json
+	sample  float64
+	exclude []string
+
+	mu     sync.Mutex
+	out    io.Writer
+	logger *slog.Logger // для json
+}
+
+// newAccessLog создаёт журнал запросов в формате format (combined, json или
+// off - тогда nil). Из успешных запросов записывается доля sample, запросы
+// с путями, начинающимися с exclude, не записываются
+func newAccessLog(out io.Writer, format string, sample float64, exclude []string) (*accessLog, error) {
+	l := &accessLog{format: format, sample: sample, exclude: exclude, out: out}
+	switch format {
+	case "off":
+		return nil, nil
+	case "combined":
+	case "json":
+		logger, err := newLogger(out, "json", "info")
+		if err != nil {
+			return nil, err
+		}
+		l.logger = logger
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	return l, nil
+}
+
+// skip решает, что запрос не попадёт в журнал. Ошибки сервера
+// записываются всегда, даже если запрос не попал в выборку
+func (l *accessLog) skip(r *http.Request, status int) bool {
+	for _, prefix := range l.exclude {
+		if prefix != "" && strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return status < 500 && l.sample < 1 && rand.Float64() >= l.sample
+}
+
+// write записывает запрос r, на который ответили rec за duration
+func (l *accessLog) write(r *http.Request, rec *responseRecorder, duration time.Duration) {
+	var userID int
+	if info := requestInfoFrom(r.Context()); info != nil {
+		userID = info.UserID
+	}
+
+	if l.format == "json" {
+		l.logger.InfoContext(r.Context(), "access",
+			"remote", clientIP(r),
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"proto", r.Proto,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(duration.Microseconds())/1000,
+			"referer", r.Referer(),
+			"user_agent", r.UserAgent(),
+		)
+		return
+	}
+
+	// Combined Log Format и в конце время обработки в микросекундах (%D у Apache)
+	user := "-"
+	if userID > 0 {
+		user = strconv.Itoa(userID)
+	}
+	size := "-"
+	if rec.bytes > 0 {
+		size = strconv.Itoa(rec.bytes)
+	}
+	line := fmt.Sprintf("%s - %s [%s] %q %d %s %q %q %d\n",
+		clientIP(r), user, time.Now().Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.URL.RequestURI()+" "+r.Proto, rec.status, size,
+		r.Referer(), r.UserAgent(), duration.Microseconds())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, line)
+}
+
+// responseRecorder запоминает код ответа и сколько байт тела записано
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap нужен http.ResponseController, чтобы добраться до Flush и т.д.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequest записывает запрос в журнал после ответа, когда известны код,
+// размер и время обработки. Пользователь берётся из requestInfo: authenticate
+// кладёт его в contextKeyUser уже во вложенный контекст, который сюда не вернётся
+func (app *application) logRequest(next http.Handler) http.Handler {
+	if app.accessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			// обработчик ничего не записал - net/http ответит 200 с пустым телом
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			if !app.accessLog.skip(r, rec.status) {
+				app.accessLog.write(r, rec, time.Since(start))
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
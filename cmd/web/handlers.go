@@ -1,21 +1,41 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"snippetbox.glebich/internal/jwtAuth"
 	"snippetbox.glebich/internal/models"
 	"snippetbox.glebich/internal/validator"
 )
 
+const (
+	maxTags      = 10
+	tagCloudSize = 30
+	maxUserAgent = 255
+	// дальше страницы поиска не листают, а (page-1)*limit не переполняется
+	maxSearchPage = 1000
+
+	revokedTokensPageSize = 50
+)
+
 type snippetCreateForm struct {
 	Title   string
 	Content string
 	Expires int
+	Tags    string
+	validator.Validator
+}
+
+type snippetEditForm struct {
+	Title   string
+	Content string
 	validator.Validator
 }
 
@@ -25,6 +45,12 @@ type userLoginForm struct {
 	validator.Validator
 }
 
+type userPasswordForm struct {
+	CurrentPassword string
+	NewPassword     string
+	validator.Validator
+}
+
 type userSignupForm struct {
 	Name     string
 	Email    string
@@ -34,19 +60,32 @@ type userSignupForm struct {
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
-		app.notFound(w)
+		app.notFound(w, r)
+		return
+	}
+
+	cursor, err := parseCursor(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	snippets, err := app.snippets.Latest()
+	page, err := app.snippets.List(r.Context(), cursor, app.pageSize)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+
+	tags, err := app.snippets.TagCloud(r.Context(), tagCloudSize)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
 	data := app.newTemplateData(r)
-	data.Snippets = snippets
-	app.render(w, http.StatusOK, "home.html", data)
+	data.setPage(page, "/")
+	data.TagCloud = tags
+	app.render(w, r, http.StatusOK, "home.html", data)
 	/*
 		for _, snippet := range snippets {
 			fmt.Fprintf(w, "%+v\n", snippet)
@@ -55,28 +94,108 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	*/
 }
 
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(r.PathValue("name"))
+	if !validator.ValidTag(tag) {
+		app.notFound(w, r)
+		return
+	}
+
+	cursor, err := parseCursor(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	page, err := app.snippets.ByTag(r.Context(), tag, cursor, app.pageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tag = tag
+	data.setPage(page, tagURL(tag))
+	app.render(w, r, http.StatusOK, "tag.html", data)
+}
+
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	page := 1
+	if value := r.URL.Query().Get("page"); value != "" {
+		var err error
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 || page > maxSearchPage {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Query = query
+	if query == "" {
+		app.render(w, r, http.StatusOK, "search.html", data)
+		return
+	}
+
+	results, more, err := app.snippets.Search(r.Context(), query, page, app.pageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.SearchResults = results
+	if page > 1 {
+		data.PrevURL = searchURL(query, page-1)
+	}
+	if more {
+		data.NextURL = searchURL(query, page+1)
+	}
+	app.render(w, r, http.StatusOK, "search.html", data)
+}
+
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
-	snippet, err := app.snippets.Get(id)
+
+	var snippet *models.Snippet
+	if rev := r.URL.Query().Get("rev"); rev != "" {
+		var number int
+		number, err = strconv.Atoi(rev)
+		if err != nil || number < 1 {
+			app.notFound(w, r)
+			return
+		}
+		snippet, err = app.snippets.GetRevision(r.Context(), id, number)
+	} else {
+		snippet, err = app.snippets.Get(r.Context(), id)
+	}
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
+	revisions, err := app.snippets.Revisions(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	// чтобы убрать экранированные знаки переноса строки
 	snippet.Content = strings.Replace(snippet.Content, "\\n", "\n", -1)
 
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
-	app.render(w, http.StatusOK, "view.html", data)
+	data.Revisions = revisions
+	app.render(w, r, http.StatusOK, "view.html", data)
 
 	//fmt.Fprintf(w, "Display a specific snippet with ID %d...\n", id)
 	//fmt.Fprintf(w, "%+v", snippet)
@@ -88,7 +207,7 @@ func (app *application) snippetCreateGet(w http.ResponseWriter, r *http.Request)
 		Expires: 365,
 	}
 
-	app.render(w, http.StatusOK, "create.html", data)
+	app.render(w, r, http.StatusOK, "create.html", data)
 }
 
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
@@ -100,19 +219,19 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 			//w.WriteHeader(http.StatusMethodNotAllowed)
 			//w.Write([]byte("POST only"))
 			//http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			app.clientError(w, http.StatusMethodNotAllowed)
+			app.clientError(w, r, http.StatusMethodNotAllowed)
 			return
 		}
 	*/
 	err := r.ParseForm()
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
 	expires, err := strconv.Atoi(r.PostForm.Get("expires"))
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
@@ -120,40 +239,151 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		Title:   r.PostForm.Get("title"),
 		Content: r.PostForm.Get("content"),
 		Expires: expires,
+		Tags:    r.PostForm.Get("tags"),
 	}
+	tags := parseTags(form.Tags)
 
 	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
 	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
 	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
 	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(validator.MaxItems(tags, maxTags), "tags", fmt.Sprintf("You cannot add more than %d tags", maxTags))
+	for _, tag := range tags {
+		form.CheckField(validator.MaxChars(tag, 30), "tags", "Each tag cannot be more than 30 characters long")
+		form.CheckField(validator.ValidTag(tag), "tags", "Tags can only contain letters, numbers and symbols + # . _ -")
+	}
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "create.html", data)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	id, err := app.snippets.Insert(r.Context(), form.Title, form.Content, form.Expires, authenticatedUser(r).ID, tags)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
+	app.metrics.snippetsCreated.Inc()
 
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
+func (app *application) snippetEditGet(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{
+		Title:   snippet.Title,
+		Content: snippet.Content,
+	}
+	app.render(w, r, http.StatusOK, "edit.html", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := snippetEditForm{
+		Title:   r.PostForm.Get("title"),
+		Content: r.PostForm.Get("content"),
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.html", data)
+		return
+	}
+
+	// если ничего не поменялось, новая ревизия не нужна
+	if form.Title != snippet.Title || form.Content != snippet.Content {
+		_, err = app.snippets.Update(r.Context(), snippet.ID, snippet.UserID, form.Title, form.Content)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	app.trashAction(w, r, app.snippets.Delete, "/user/snippets")
+}
+
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	app.trashAction(w, r, app.snippets.Restore, "/user/trash")
+}
+
+func (app *application) snippetPurgePost(w http.ResponseWriter, r *http.Request) {
+	app.trashAction(w, r, app.snippets.Purge, "/user/trash")
+}
+
+func (app *application) userTrash(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Trash(r.Context(), authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	app.render(w, r, http.StatusOK, "trash.html", data)
+}
+
+func (app *application) userSnippets(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.ByUser(r.Context(), authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	for _, s := range snippets {
+		if expired(s.Expires) {
+			data.ExpiredCount++
+		} else {
+			data.ActiveCount++
+		}
+	}
+	app.render(w, r, http.StatusOK, "snippets.html", data)
+}
+
 func (app *application) userSignupGet(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userSignupForm{}
 
-	app.render(w, http.StatusOK, "signup.html", data)
+	app.render(w, r, http.StatusOK, "signup.html", data)
 }
 
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	form := userSignupForm{
@@ -170,33 +400,35 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
 		return
 	}
 
-	id, err := app.users.Insert(form.Name, form.Email, form.Password)
+	id, err := app.users.Insert(r.Context(), form.Name, form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicateEntry) {
 			form.AddFieldError("email", "This email is already in use")
 
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.html", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	err = app.GenerateRefreshTokenAndCookie(w, id)
+	refreshToken, err := app.GenerateRefreshTokenAndCookie(w, r, id)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	err = CreateJWTTokenAndSetCookie(form.Name, form.Email, id, w)
+	// у нового пользователя первая версия токенов и нет ролей
+	user := &jwtAuth.Sub{ID: id, Name: form.Name, Email: form.Email, TokenVersion: 1}
+	err = app.CreateJWTTokenAndSetCookie(r.Context(), user, refreshToken, w)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -207,13 +439,13 @@ func (app *application) userLoginGet(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userLoginForm{}
 
-	app.render(w, http.StatusOK, "login.html", data)
+	app.render(w, r, http.StatusOK, "login.html", data)
 }
 
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
@@ -222,12 +454,12 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		Password: r.PostForm.Get("password"),
 	}
 
-	user, err := app.users.Get(form.Email, form.Password)
+	user, err := app.users.Get(r.Context(), form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrWrongCredentials) {
 			form.AddFieldError("credentials", "Wrong Credentials")
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 			return
 		}
 	}
@@ -235,51 +467,52 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
 		return
 	}
 
-	err = CreateJWTTokenAndSetCookie(user.Name, user.Email, user.ID, w)
+	refreshToken, err := app.GenerateRefreshTokenAndCookie(w, r, user.ID)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	err = app.GenerateRefreshTokenAndCookie(w, user.ID)
+	err = app.CreateJWTTokenAndSetCookie(r.Context(), &jwtAuth.Sub{
+		ID:           user.ID,
+		Name:         user.Name,
+		Email:        user.Email,
+		Roles:        user.Roles,
+		TokenVersion: user.TokenVersion,
+	}, refreshToken, w)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
 	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-
-	err := app.refreshTokens.Delete(data.User.ID)
-	if err != nil {
-		app.serverError(w, fmt.Errorf("fr I don't know WTF"))
+	// выход завершает только сессию этого устройства, остальные остаются
+	session, err := app.currentSession(r)
+	if err == nil {
+		err = app.refreshTokens.Revoke(r.Context(), session.FamilyID, authenticatedUser(r).ID)
+		if err == nil {
+			// другие JWT этой сессии отозваны в БД, здесь они должны перестать действовать сразу
+			app.syncRevokedTokens(r.Context())
+		}
+	}
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	// без этого украденный auth_token действовал бы ещё до 15 минут
+	if err = app.revokeCurrentAccessToken(r); err != nil {
+		app.serverError(w, r, err)
+		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "auth_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true, // если HTTPS - true, локальная разработка - false
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   -1,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true, // если HTTPS - true, локальная разработка - false
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   -1,
-	})
+	clearAuthCookies(w)
 
 	// наверно, можно передавать в контекст ещё разные сообщения,
 	// чтобы информационные уведомления показывать типа
@@ -287,6 +520,252 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func ping(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
+func (app *application) userPasswordGet(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userPasswordForm{}
+
+	app.render(w, r, http.StatusOK, "password.html", data)
+}
+
+func (app *application) userPasswordPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	form := userPasswordForm{
+		CurrentPassword: r.PostForm.Get("currentPassword"),
+		NewPassword:     r.PostForm.Get("newPassword"),
+	}
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
+	form.CheckField(validator.ValidPassword(form.NewPassword), "newPassword", "Password must contain 1 number (0-9), 1 uppercase letter, 1 lowercase letter, 1 non-alpha numeric number, password is 8-16 characters with no space")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "password.html", data)
+		return
+	}
+
+	user := authenticatedUser(r)
+	version, err := app.users.PasswordUpdate(r.Context(), user.ID, form.CurrentPassword, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrWrongCredentials) {
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "password.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	// JWT со старой версией истекут не позже, чем через время жизни токена
+	err = app.revokedTokens.RevokeVersion(r.Context(), user.ID, version, time.Now().Add(app.jwtKeys.TTL))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// JWT других устройств уже не действуют, а без refresh токенов
+	// они не получат новые - после смены пароля остаётся только эта сессия
+	current, err := app.currentSession(r)
+	if err == nil {
+		err = app.refreshTokens.RevokeOthers(r.Context(), current.FamilyID, user.ID)
+	} else if errors.Is(err, models.ErrNoRecord) {
+		err = app.refreshTokens.Delete(r.Context(), user.ID)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var refreshToken string
+	if cookie, err := r.Cookie("refresh_token"); err == nil {
+		refreshToken = cookie.Value
+	}
+	updated := *user
+	updated.TokenVersion = version
+	err = app.CreateJWTTokenAndSetCookie(r.Context(), &updated, refreshToken, w)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+func (app *application) userSessions(w http.ResponseWriter, r *http.Request) {
+	current, err := app.currentSession(r)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sessions, err := app.refreshTokens.Sessions(r.Context(), authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	if current != nil {
+		data.CurrentSession = current.FamilyID
+	}
+	app.render(w, r, http.StatusOK, "sessions.html", data)
+}
+
+func (app *application) sessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	current, err := app.currentSession(r)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.refreshTokens.Revoke(r.Context(), id, authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.syncRevokedTokens(r.Context())
+
+	// завершить текущую сессию - то же самое, что выйти
+	if current != nil && current.FamilyID == id {
+		if err = app.revokeCurrentAccessToken(r); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		clearAuthCookies(w)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+func (app *application) sessionRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	current, err := app.currentSession(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, r, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.refreshTokens.RevokeOthers(r.Context(), current.FamilyID, authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.syncRevokedTokens(r.Context())
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+type adminRevokeForm struct {
+	JTI string
+	validator.Validator
+}
+
+func (app *application) adminTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderAdminTokens(w, r, http.StatusOK, adminRevokeForm{})
+}
+
+func (app *application) renderAdminTokens(w http.ResponseWriter, r *http.Request, status int, form adminRevokeForm) {
+	tokens, err := app.revokedTokens.Recent(r.Context(), revokedTokensPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.RevokedTokens = tokens
+	data.Form = form
+	app.render(w, r, status, "admin_tokens.html", data)
+}
+
+// adminRevokePost отзывает access токен по jti, например найденный через
+// интроспекцию. Срок токена неизвестен, поэтому запись хранится столько,
+// сколько может жить самый свежий токен
+func (app *application) adminRevokePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	form := adminRevokeForm{
+		JTI: strings.TrimSpace(r.PostForm.Get("jti")),
+	}
+	form.CheckField(validator.NotBlank(form.JTI), "jti", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.JTI, 64), "jti", "This field cannot be more than 64 characters long")
+
+	if !form.Valid() {
+		app.renderAdminTokens(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	err = app.revokedTokens.Revoke(r.Context(), form.JTI, 0, time.Now().Add(app.jwtKeys.TTL))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.logger.InfoContext(r.Context(), "admin revoked access token", "jti", form.JTI)
+
+	http.Redirect(w, r, "/admin/tokens", http.StatusSeeOther)
+}
+
+// jwks публикует открытые ключи, которыми другие сервисы проверяют JWT snippetbox
+func (app *application) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	app.writeJSON(w, r, http.StatusOK, app.jwtKeys.JWKS())
+}
+
+// introspect отвечает, действует ли access токен и кому он принадлежит (RFC 7662).
+// Спрашивать могут только сервисы, знающие introspect-secret (RFC 7662, 2.1)
+func (app *application) introspect(w http.ResponseWriter, r *http.Request) {
+	if !app.introspectClient(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="snippetbox"`)
+		app.clientError(w, r, http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 8192)
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	claims, err := app.jwtKeys.ParseClaims(token)
+	if err != nil {
+		app.writeJSON(w, r, http.StatusOK, jwtAuth.Introspection{})
+		return
+	}
+	if _, err := app.checkClaims(claims); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			app.serverError(w, r, err)
+			return
+		}
+		app.writeJSON(w, r, http.StatusOK, jwtAuth.Introspection{})
+		return
+	}
+	app.writeJSON(w, r, http.StatusOK, claims.Introspection())
 }
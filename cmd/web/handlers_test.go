@@ -1,29 +1,772 @@
 package main
 
 import (
-	"bytes"
-	"io"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"snippetbox.glebich/internal/assert"
+	"snippetbox.glebich/internal/jwtAuth"
+	"snippetbox.glebich/internal/models"
 )
 
-func TestPing(t *testing.T) {
-	rr := httptest.NewRecorder()
-	r, err := http.NewRequest(http.MethodGet, "/", nil)
+func TestHealthz(t *testing.T) {
+	app := newTestApplication(t)
+	// БД недоступна, но процесс жив
+	app.readiness.db = stubPinger{err: errors.New("connection refused")}
+	ts := newTestServer(t, app.routes())
+
+	code, header, body := ts.get(t, "/healthz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body, `{"status":"ok"}`)
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+	// мимо цепочки middleware: ни request ID, ни CSRF куки
+	assert.Equal(t, header.Get("X-Request-ID"), "")
+	assert.Equal(t, len(header.Values("Set-Cookie")), 0)
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		db         error
+		migrations stubMigrations
+		draining   bool
+		emptyCache bool
+		wantCode   int
+		wantChecks map[string]string
+	}{
+		{
+			name:       "Ready",
+			migrations: stubMigrations{upToDate: true},
+			wantCode:   http.StatusOK,
+			wantChecks: map[string]string{"database": "ok", "templates": "ok", "migrations": "ok", "shutdown": "ok"},
+		},
+		{
+			name:       "Database down",
+			db:         errors.New("dial tcp: connection refused"),
+			migrations: stubMigrations{err: errors.New("dial tcp: connection refused")},
+			wantCode:   http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"database": "dial tcp: connection refused", "migrations": "dial tcp: connection refused"},
+		},
+		{
+			name:       "Migrations pending",
+			migrations: stubMigrations{upToDate: false},
+			wantCode:   http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"database": "ok", "migrations": "migrations are pending"},
+		},
+		{
+			name:       "No templates",
+			migrations: stubMigrations{upToDate: true},
+			emptyCache: true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"templates": "template cache is empty"},
+		},
+		{
+			name:       "Draining",
+			migrations: stubMigrations{upToDate: true},
+			draining:   true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"database": "ok", "shutdown": "shutting down"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.readiness = &readiness{db: stubPinger{err: tt.db}, migrations: tt.migrations}
+			app.readiness.draining.Store(tt.draining)
+			if tt.emptyCache {
+				app.templateCache = nil
+			}
+			// подробности видны только на служебном адресе
+			rr := httptest.NewRecorder()
+			app.adminRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, rr.Code, tt.wantCode)
+
+			var health Health
+			if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, health.Status == "ready", tt.wantCode == http.StatusOK)
+			for name, want := range tt.wantChecks {
+				assert.Equal(t, health.Checks[name], want)
+			}
+		})
+	}
+
+	t.Run("Public listener hides database errors", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.readiness.db = stubPinger{err: errors.New("dial tcp 10.0.0.5:5432: connection refused")}
+		app.readiness.draining.Store(true)
+		ts := newTestServer(t, app.routes())
+
+		code, _, body := ts.get(t, "/readyz")
+		assert.Equal(t, code, http.StatusServiceUnavailable)
+		assert.Equal(t, body, `{"status":"unavailable","checks":{"database":"failed","migrations":"ok","shutdown":"shutting down","templates":"ok"}}`)
+	})
+
+	t.Run("Migrations checked until applied", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+
+		code, _, _ := ts.get(t, "/readyz")
+		assert.Equal(t, code, http.StatusOK)
+		// после первого успешного ответа миграции больше не проверяются
+		app.readiness.migrations = stubMigrations{err: errors.New("must not be called")}
+		code, _, _ = ts.get(t, "/readyz")
+		assert.Equal(t, code, http.StatusOK)
+	})
+}
+
+func TestSnippetView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	id, err := app.snippets.Insert(context.Background(), "An old silent pond", "An old silent pond...", 7, 1, []string{"haiku"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  fmt.Sprintf("/snippet/view/%d", id),
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond...",
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/view/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Negative ID",
+			urlPath:  "/snippet/view/-1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/snippet/view/foo",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent revision",
+			urlPath:  fmt.Sprintf("/snippet/view/%d?rev=2", id),
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	_, err := app.snippets.Insert(context.Background(), "An old silent pond", "An old silent pond...", 7, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Found",
+			urlPath:  "/search?q=pond",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond",
+		},
+		{
+			name:     "Last page",
+			urlPath:  fmt.Sprintf("/search?q=pond&page=%d", maxSearchPage),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Page too large",
+			urlPath:  "/search?q=pond&page=9223372036854775807",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Zero page",
+			urlPath:  "/search?q=pond&page=0",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			}
+		})
+	}
+}
+
+func TestUserSignup(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	_, err := app.users.Insert(context.Background(), "Bob", "dupe@example.com", "Pa$$w0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validCSRFToken := ts.csrfToken(t, "/user/signup")
+
+	tests := []struct {
+		name      string
+		userName  string
+		userEmail string
+		password  string
+		csrfToken string
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:      "Invalid CSRF Token",
+			userName:  "alice",
+			userEmail: "alice@example.com",
+			password:  "Pa$$w0rd",
+			csrfToken: "wrongToken",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Short name",
+			userName:  "al",
+			userEmail: "al@example.com",
+			password:  "Pa$$w0rd",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must contain more than 3 characters",
+		},
+		{
+			name:      "Invalid email",
+			userName:  "carol",
+			userEmail: "carol@",
+			password:  "Pa$$w0rd",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "Please enter correct email",
+		},
+		{
+			name:      "Weak password",
+			userName:  "carol",
+			userEmail: "carol@example.com",
+			password:  "password",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "Password must contain",
+		},
+		{
+			name:      "Duplicate email",
+			userName:  "bobby",
+			userEmail: "dupe@example.com",
+			password:  "Pa$$w0rd",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This email is already in use",
+		},
+		{
+			name:      "Valid submission",
+			userName:  "alice",
+			userEmail: "alice@example.com",
+			password:  "Pa$$w0rd",
+			csrfToken: validCSRFToken,
+			wantCode:  http.StatusSeeOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", tt.userName)
+			form.Add("email", tt.userEmail)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/signup", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			}
+		})
+	}
+}
+
+func TestUserLogin(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	_, err := app.users.Insert(context.Background(), "alice", "alice@example.com", "Pa$$w0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantCode int
+	}{
+		{
+			name:     "Wrong password",
+			email:    "alice@example.com",
+			password: "Wr0ng$pass",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Unknown email",
+			email:    "bob@example.com",
+			password: "Pa$$w0rd",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Valid credentials",
+			email:    "alice@example.com",
+			password: "Pa$$w0rd",
+			wantCode: http.StatusSeeOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", ts.csrfToken(t, "/user/login"))
+
+			code, _, body := ts.postForm(t, "/user/login", form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusUnprocessableEntity {
+				assert.Equal(t, strings.Contains(body, "Wrong Credentials"), true)
+			}
+		})
+	}
+
+	// куки, полученные при входе, дают доступ к защищённым страницам
+	code, _, body := ts.get(t, "/user/snippets")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Log Out"), true)
+}
+
+func TestSnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/create")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+
+	t.Run("Authenticated", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/create")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "<form action='/snippet/create' method='POST'>"), true)
+	})
+
+	tests := []struct {
+		name         string
+		title        string
+		content      string
+		expires      string
+		tags         string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Valid submission",
+			title:        "O snail",
+			content:      "O snail\nClimb Mount Fuji,\nBut slowly, slowly!",
+			expires:      "7",
+			tags:         "haiku, Issa",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/1",
+		},
+		{
+			name:     "Blank title",
+			title:    "",
+			content:  "O snail",
+			expires:  "7",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Wrong expires",
+			title:    "O snail",
+			content:  "O snail",
+			expires:  "30",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must equal 1, 7 or 365",
+		},
+		{
+			name:     "Invalid tag",
+			title:    "O snail",
+			content:  "O snail",
+			expires:  "7",
+			tags:     "haiku, <script>",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Tags can only contain",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", tt.content)
+			form.Add("expires", tt.expires)
+			form.Add("tags", tt.tags)
+			form.Add("csrf_token", ts.csrfToken(t, "/snippet/create"))
+
+			code, header, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			}
+		})
+	}
+
+	t.Run("View created", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "Climb Mount Fuji"), true)
+		assert.Equal(t, strings.Contains(body, "href='/tag/issa'"), true)
+		assert.Equal(t, strings.Contains(body, "href='/snippet/edit/1'"), true)
+	})
+}
+
+// slowSnippets имитирует БД, которая не успела ответить за таймаут запроса
+type slowSnippets struct {
+	models.SnippetModelInterface
+}
+
+func (m slowSnippets) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	return nil, fmt.Errorf("%w: canceling statement due to user request", context.DeadlineExceeded)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	app := newTestApplication(t)
+	app.snippets = slowSnippets{app.snippets}
+	ts := newTestServer(t, app.routes())
+
+	code, header, body := ts.get(t, "/snippet/view/1")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.Equal(t, body, http.StatusText(http.StatusServiceUnavailable)+"\nRequest ID: "+header.Get("X-Request-ID"))
+}
+
+func TestClientErrorRequestID(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Not found",
+			urlPath:  "/snippet/view/foo",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Bad request",
+			urlPath:  "/search?q=pond&page=0",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, body, http.StatusText(tt.wantCode)+"\nRequest ID: "+header.Get("X-Request-ID"))
+		})
+	}
+
+	t.Run("CSRF failure", func(t *testing.T) {
+		code, header, body := ts.postForm(t, "/user/login", url.Values{})
+		assert.Equal(t, code, http.StatusBadRequest)
+		assert.Equal(t, body, http.StatusText(http.StatusBadRequest)+"\nRequest ID: "+header.Get("X-Request-ID"))
+	})
+}
+
+func TestUserSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+	// вход с другого устройства
+	err := app.refreshTokens.Insert(context.Background(), "desktop", 1, 1, "Desktop browser", "192.0.2.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, body := ts.get(t, "/user/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Desktop browser"), true)
+	assert.Equal(t, strings.Contains(body, "This device"), true)
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, header, _ := ts.postForm(t, "/user/sessions/revoke-others", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/sessions")
+
+	_, _, body = ts.get(t, "/user/sessions")
+	assert.Equal(t, strings.Contains(body, "Desktop browser"), false)
+	assert.Equal(t, strings.Contains(body, "This device"), true)
+
+	t.Run("Revoke foreign session", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/user/sessions/revoke/100", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	code, _, _ = ts.postForm(t, "/user/logout", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	sessions, err := app.refreshTokens.Sessions(context.Background(), 1)
 	if err != nil {
 		t.Fatal(err)
 	}
-	ping(rr, r)
-	rs := rr.Result()
-	assert.Equal(t, rs.StatusCode, http.StatusOK)
-	defer rs.Body.Close()
-	body, err := io.ReadAll(rs.Body)
+	assert.Equal(t, len(sessions), 0)
+}
+
+func TestSessionUserAgent(t *testing.T) {
+	app := newTestApplication(t)
+
+	userAgent := "Mozilla/5.0 " + strings.Repeat("я", 200) + "\xff"
+	r := httptest.NewRequest(http.MethodPost, "/user/login", nil)
+	r.Header.Set("User-Agent", userAgent)
+	_, err := app.GenerateRefreshTokenAndCookie(httptest.NewRecorder(), r, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
-	bytes.TrimSpace(body)
-	assert.Equal(t, string(body), "OK")
+
+	sessions, err := app.refreshTokens.Sessions(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(sessions), 1)
+	got := sessions[0].UserAgent
+	assert.Equal(t, utf8.ValidString(got), true)
+	assert.Equal(t, len(got) <= maxUserAgent, true)
+	assert.Equal(t, strings.HasPrefix(userAgent, got), true)
+	assert.Equal(t, len(got) > maxUserAgent-utf8.UTFMax, true)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+
+	serverURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// JWT истёк - браузер его больше не отправляет
+	expireJWT := func() {
+		ts.Client().Jar.SetCookies(serverURL, []*http.Cookie{{Name: "auth_token", Path: "/", MaxAge: -1}})
+	}
+
+	first := ts.cookie(t, "refresh_token")
+	expireJWT()
+	code, _, body := ts.get(t, "/user/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "This device"), true)
+
+	second := ts.cookie(t, "refresh_token")
+	assert.Equal(t, second != "" && second != first, true)
+	sessions, err := app.refreshTokens.Sessions(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(sessions), 1)
+}
+
+func TestIntrospect(t *testing.T) {
+	app := newTestApplication(t)
+	app.clientSecret = "s3cret"
+	ts := newTestServer(t, app.routes())
+
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+
+	accessToken := ts.cookie(t, "auth_token")
+
+	tests := []struct {
+		name       string
+		token      string
+		secret     string
+		basic      bool
+		wantCode   int
+		wantActive bool
+	}{
+		{name: "Valid token", token: accessToken, secret: "s3cret", wantCode: http.StatusOK, wantActive: true},
+		{name: "Basic auth", token: accessToken, secret: "s3cret", basic: true, wantCode: http.StatusOK, wantActive: true},
+		{name: "Invalid token", token: "not-a-token", secret: "s3cret", wantCode: http.StatusOK, wantActive: false},
+		{name: "No secret", token: accessToken, wantCode: http.StatusUnauthorized},
+		{name: "Wrong secret", token: accessToken, secret: "guess", wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// сервис обращается без кук и CSRF токена
+			form := url.Values{}
+			form.Add("token", tt.token)
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/oauth/introspect", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			switch {
+			case tt.basic:
+				req.SetBasicAuth("reports", tt.secret)
+			case tt.secret != "":
+				req.Header.Set("Authorization", "Bearer "+tt.secret)
+			}
+			client := &http.Client{Transport: ts.Client().Transport}
+			rs, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+			assert.Equal(t, rs.StatusCode, tt.wantCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var info jwtAuth.Introspection
+			if err := json.NewDecoder(rs.Body).Decode(&info); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, info.Active, tt.wantActive)
+			if tt.wantActive {
+				assert.Equal(t, info.Sub, "1")
+				assert.Equal(t, info.Email, "alice@example.com")
+			}
+		})
+	}
+
+	t.Run("JWKS", func(t *testing.T) {
+		code, header, body := ts.get(t, "/.well-known/jwks.json")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "application/json")
+		assert.Equal(t, body, `{"keys":[]}`)
+	})
+}
+
+func TestUserPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+	// вход с другого устройства
+	err := app.refreshTokens.Insert(context.Background(), "desktop", 1, 1, "Desktop browser", "192.0.2.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken := ts.cookie(t, "auth_token")
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		newPassword     string
+		wantCode        int
+		wantBody        string
+	}{
+		{
+			name:            "Wrong current password",
+			currentPassword: "Wr0ng$pass",
+			newPassword:     "N3w$pass",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantBody:        "Current password is incorrect",
+		},
+		{
+			name:            "Weak new password",
+			currentPassword: "Pa$$w0rd",
+			newPassword:     "password",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantBody:        "Password must contain",
+		},
+		{
+			name:            "Valid submission",
+			currentPassword: "Pa$$w0rd",
+			newPassword:     "N3w$pass",
+			wantCode:        http.StatusSeeOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("currentPassword", tt.currentPassword)
+			form.Add("newPassword", tt.newPassword)
+			form.Add("csrf_token", ts.csrfToken(t, "/user/password"))
+
+			code, _, body := ts.postForm(t, "/user/password", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+			}
+		})
+	}
+
+	// JWT, выданный до смены пароля, больше не действует
+	assert.Equal(t, ts.cookie(t, "auth_token") != oldToken, true)
+	_, err = app.verifyAccessToken(oldToken)
+	assert.Equal(t, errors.Is(err, jwtAuth.ErrStaleToken), true)
+
+	// другие устройства вышли, это осталось в сессии
+	code, _, body := ts.get(t, "/user/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "Desktop browser"), false)
+	assert.Equal(t, strings.Contains(body, "This device"), true)
+}
+
+func TestAccessTokenRevocation(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+
+	accessToken := ts.cookie(t, "auth_token")
+	_, err := app.verifyAccessToken(accessToken)
+	assert.Equal(t, err, nil)
+
+	t.Run("Admin only", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/admin/tokens")
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+
+	form := url.Values{}
+	form.Add("csrf_token", ts.csrfToken(t, "/user/sessions"))
+	code, _, _ := ts.postForm(t, "/user/logout", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// украденный до выхода auth_token больше не действует
+	_, err = app.verifyAccessToken(accessToken)
+	assert.Equal(t, errors.Is(err, jwtAuth.ErrRevokedToken), true)
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readyTimeout ограничивает проверки в readyz: оркестратор ждёт ответа
+// недолго, и медленная БД должна означать "не готов", а не зависший запрос
+const readyTimeout = 2 * time.Second
+
+// pinger - *sql.DB
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// migrationChecker - *migrate.Migrator
+type migrationChecker interface {
+	UpToDate(ctx context.Context) (bool, error)
+}
+
+// readiness - зависимости, без которых сервер не должен получать трафик
+type readiness struct {
+	db         pinger
+	migrations migrationChecker
+
+	// migrated запоминает, что миграции применены, - дальше их можно не проверять
+	migrated atomic.Bool
+	draining atomic.Bool
+}
+
+// Health - ответ /healthz и /readyz
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// healthz отвечает, пока процесс жив и обрабатывает запросы. Зависимости
+// не проверяет: перезапуск процесса не вылечит упавшую БД
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	app.writeJSON(w, r, http.StatusOK, Health{Status: "ok"})
+}
+
+// readyz отвечает 200, если сервер может обслуживать пользователей, и 503
+// с причиной в checks, если нет. Ошибки БД на основном адресе заменяются
+// на "failed": текст ошибки драйвера выдаёт адрес сервера БД и т.п.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	app.checkReadiness(w, r, false)
+}
+
+// readyzDetail - readyz для служебного адреса, с текстом ошибок БД
+func (app *application) readyzDetail(w http.ResponseWriter, r *http.Request) {
+	app.checkReadiness(w, r, true)
+}
+
+func (app *application) checkReadiness(w http.ResponseWriter, r *http.Request, detailed bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]string{}
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+	dbError := func(err error) error {
+		if err != nil && !detailed {
+			return errors.New("failed")
+		}
+		return err
+	}
+
+	check("database", dbError(app.readiness.db.PingContext(ctx)))
+
+	var err error
+	if len(app.templateCache) == 0 {
+		err = fmt.Errorf("template cache is empty")
+	}
+	check("templates", err)
+
+	err = nil
+	if !app.readiness.migrated.Load() {
+		var ok bool
+		ok, err = app.readiness.migrations.UpToDate(ctx)
+		err = dbError(err)
+		if err == nil && !ok {
+			err = fmt.Errorf("migrations are pending")
+		}
+		app.readiness.migrated.Store(err == nil)
+	}
+	check("migrations", err)
+
+	err = nil
+	if app.readiness.draining.Load() {
+		err = fmt.Errorf("shutting down")
+	}
+	check("shutdown", err)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if !ready {
+		app.writeJSON(w, r, http.StatusServiceUnavailable, Health{Status: "unavailable", Checks: checks})
+		return
+	}
+	app.writeJSON(w, r, http.StatusOK, Health{Status: "ready", Checks: checks})
+}
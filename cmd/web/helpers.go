@@ -2,46 +2,98 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"runtime/debug"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/justinas/nosurf"
+	"go.opentelemetry.io/otel"
 	"snippetbox.glebich/internal/jwtAuth"
+	"snippetbox.glebich/internal/models"
 )
 
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	// выводится вторая запись в трейсе, а не первая:
-	// первая запись указывает на строку в этом файле, а вторая - откуда
-	// была вызвана эта строка, то есть конкретное место ошибки
-	app.errorLog.Output(2, trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+// serverError пишет ошибку в лог вместе с местом, откуда её вернули, и
+// отвечает 500. В ответе есть ID запроса, по которому запись находится в логах
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	// БД не ответила за отведённое время - это временная недоступность,
+	// а не ошибка в коде, поэтому 503
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+	}
+
+	// место вызова serverError, а не сама эта функция, - там и случилась ошибка
+	attrs := []any{"err", err.Error(), "status", status, "method", r.Method, "uri", r.URL.RequestURI()}
+	if _, file, line, ok := runtime.Caller(1); ok {
+		attrs = append(attrs, "source", fmt.Sprintf("%s:%d", filepath.Base(file), line))
+	}
+	app.logger.ErrorContext(r.Context(), "server error", attrs...)
+
+	app.errorPage(w, r, status)
+}
+
+// errorPage отвечает текстом статуса и ID запроса, который пользователь
+// может передать в поддержку
+func (app *application) errorPage(w http.ResponseWriter, r *http.Request, status int) {
+	body := http.StatusText(status)
+	if id := requestID(r); id != "" {
+		body += "\nRequest ID: " + id
+	}
+	http.Error(w, body, status)
 }
 
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+// clientError отвечает на ошибку в запросе. ID запроса тоже в ответе:
+// пользователь может спросить, почему его запрос не приняли
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorPage(w, r, status)
 }
 
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
 }
 
-func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound)
+}
+
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data *templateData) {
 	ts, ok := app.templateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	buf := new(bytes.Buffer)
 
+	_, span := otel.Tracer(tracerName).Start(r.Context(), "render "+page)
+	start := time.Now()
 	err := ts.ExecuteTemplate(buf, "base", data)
+	app.metrics.renderDuration.WithLabelValues(page).Observe(time.Since(start).Seconds())
+	span.End()
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -55,14 +107,120 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 		CurrentYear: time.Now().Year(),
 		CSRFToken:   nosurf.Token(r),
 	}
-	if user, ok := r.Context().Value(contextKeyUser).(*jwtAuth.Sub); ok {
-		td.User = user
-	}
+	td.User = authenticatedUser(r)
 	return td
 }
 
-func CreateJWTTokenAndSetCookie(name, email string, id int, w http.ResponseWriter) error {
-	tokenString, err := jwtAuth.CreateJWTToken(name, email, id)
+// authenticatedUser возвращает пользователя, которого положил в контекст
+// authenticate, или nil, если запрос анонимный
+func authenticatedUser(r *http.Request) *jwtAuth.Sub {
+	user, ok := r.Context().Value(contextKeyUser).(*jwtAuth.Sub)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// ownSnippet достаёт сниппет из пути запроса и проверяет, что он принадлежит
+// текущему пользователю. Если нет - сам отвечает клиенту и возвращает false
+func (app *application) ownSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if snippet.UserID != authenticatedUser(r).ID {
+		app.clientError(w, r, http.StatusForbidden)
+		return nil, false
+	}
+	return snippet, true
+}
+
+// trashAction выполняет над своим сниппетом действие с корзиной
+// (удалить, восстановить, удалить навсегда) и перенаправляет на redirect
+func (app *application) trashAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, id, userID int) error, redirect string) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = action(r.Context(), id, authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// parseCursor читает курсор пагинации из параметров ?after= и ?before=
+func parseCursor(r *http.Request) (models.Cursor, error) {
+	var cursor models.Cursor
+	for key, dst := range map[string]*int{"after": &cursor.After, "before": &cursor.Before} {
+		value := r.URL.Query().Get(key)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			return models.Cursor{}, fmt.Errorf("invalid %s cursor %q", key, value)
+		}
+		*dst = id
+	}
+	return cursor, nil
+}
+
+// parseTags разбирает теги, введённые через запятую или пробел.
+// Теги приводятся к нижнему регистру, повторы отбрасываются
+func parseTags(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	tags := []string{}
+	for _, field := range fields {
+		tag := strings.ToLower(field)
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func tagURL(tag string) string {
+	return "/tag/" + url.PathEscape(tag)
+}
+
+func searchURL(query string, page int) string {
+	values := url.Values{}
+	values.Set("q", query)
+	values.Set("page", strconv.Itoa(page))
+	return "/search?" + values.Encode()
+}
+
+// CreateJWTTokenAndSetCookie выдаёт access токен и привязывает его к сессии
+// refreshToken, чтобы при завершении сессии отозвать и его
+func (app *application) CreateJWTTokenAndSetCookie(ctx context.Context, user *jwtAuth.Sub, refreshToken string, w http.ResponseWriter) error {
+	tokenString, claims, err := app.jwtKeys.CreateJWTToken(user)
+	if err != nil {
+		return err
+	}
+	err = app.refreshTokens.SetAccessToken(ctx, refreshToken, claims.ID, claims.ExpiresAt.Time)
 	if err != nil {
 		return err
 	}
@@ -74,40 +232,176 @@ func CreateJWTTokenAndSetCookie(name, email string, id int, w http.ResponseWrite
 		HttpOnly: true,
 		Secure:   true, // если HTTPS - true, локальная разработка - false
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   15 * 60,
+		MaxAge:   int(app.jwtKeys.TTL.Seconds()),
 	})
 
 	return nil
 }
 
-func (app *application) VerifyRefreshTokenAndCreateJWT(refreshTokenString string, w http.ResponseWriter) (*jwtAuth.Sub, error) {
-	user, err := app.refreshTokens.CheckRefreshToken(refreshTokenString)
+// VerifyRefreshTokenAndCreateJWT обменивает refresh токен из куки на новый
+// и выдаёт свежий JWT. Повторное использование уже заменённого токена
+// означает, что его украли, - сессия к этому моменту уже завершена
+func (app *application) VerifyRefreshTokenAndCreateJWT(w http.ResponseWriter, r *http.Request, refreshTokenString string) (*jwtAuth.Sub, error) {
+	newRefreshToken := rand.Text()
+	user, rotated, err := app.refreshTokens.Rotate(r.Context(), refreshTokenString, newRefreshToken, app.sessionDays, clientIP(r))
 	if err != nil {
+		// если БД не ответила, токен мог быть и валидным
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		if errors.Is(err, models.ErrTokenReused) {
+			app.logger.WarnContext(r.Context(), "security: refresh token reused, session revoked", "err", err, "ip", clientIP(r))
+			clearAuthCookies(w)
+			// access токены этой сессии отозваны в БД, здесь они должны перестать действовать сразу
+			app.syncRevokedTokens(r.Context())
+		}
 		return nil, jwtAuth.ErrInvalidRefreshToken
 	}
-	err = CreateJWTTokenAndSetCookie(user.Name, user.Email, user.ID, w)
+	// токен уже заменил параллельный запрос - новая кука придёт с его ответом
+	if rotated {
+		app.setRefreshTokenCookie(w, newRefreshToken)
+		refreshTokenString = newRefreshToken
+	}
+	err = app.CreateJWTTokenAndSetCookie(r.Context(), user, refreshTokenString, w)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
 		return nil, jwtAuth.ErrServerError
 	}
 	return user, nil
 }
 
-func (app *application) GenerateRefreshTokenAndCookie(w http.ResponseWriter, userId int) error {
+// verifyAccessToken проверяет JWT, то, что он не отозван и выдан после
+// последней смены пароля
+func (app *application) verifyAccessToken(tokenString string) (*jwtAuth.Sub, error) {
+	claims, err := app.jwtKeys.ParseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return app.checkClaims(claims)
+}
+
+// checkClaims смотрит только в память revokedTokens: БД не нужна
+// на каждый запрос, а смены пароля на других экземплярах подтягивает Sync
+func (app *application) checkClaims(claims *jwtAuth.Claims) (*jwtAuth.Sub, error) {
+	if app.revokedTokens.IsRevoked(claims.ID) {
+		return nil, jwtAuth.ErrRevokedToken
+	}
+	user, err := claims.User()
+	if err != nil {
+		return nil, err
+	}
+	if user.TokenVersion < app.revokedTokens.MinVersion(user.ID) {
+		return nil, jwtAuth.ErrStaleToken
+	}
+	return user, nil
+}
+
+// introspectClient проверяет, что в запросе есть introspect-secret:
+// Authorization: Bearer <secret> или Basic с секретом в качестве пароля
+func (app *application) introspectClient(r *http.Request) bool {
+	if app.clientSecret == "" {
+		return false
+	}
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, secret, ok = r.BasicAuth()
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(secret), []byte(app.clientSecret)) == 1
+}
+
+// GenerateRefreshTokenAndCookie открывает новую сессию для устройства,
+// с которого пришёл запрос r
+func (app *application) GenerateRefreshTokenAndCookie(w http.ResponseWriter, r *http.Request, userId int) (string, error) {
 	refreshTokenString := rand.Text()
 
-	err := app.refreshTokens.Insert(refreshTokenString, 1, userId)
+	// Postgres не примет некорректный UTF-8, поэтому обрезка идёт по границе
+	// символа, а битые байты от клиента выбрасываются
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "")
+	if len(userAgent) > maxUserAgent {
+		n := maxUserAgent
+		for n > 0 && !utf8.RuneStart(userAgent[n]) {
+			n--
+		}
+		userAgent = userAgent[:n]
+	}
+	err := app.refreshTokens.Insert(r.Context(), refreshTokenString, app.sessionDays, userId, userAgent, clientIP(r))
 	if err != nil {
-		return err
+		return "", err
 	}
 
+	app.setRefreshTokenCookie(w, refreshTokenString)
+	return refreshTokenString, nil
+}
+
+func (app *application) setRefreshTokenCookie(w http.ResponseWriter, value string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "refresh_token",
-		Value:    refreshTokenString,
+		Value:    value,
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   true, // если HTTPS - true, локальная разработка - false
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   24 * 60 * 60,
+		MaxAge:   app.sessionDays * 24 * 60 * 60,
 	})
-	return nil
+}
+
+// currentSession возвращает сессию, к которой относится refresh_token из куки запроса
+func (app *application) currentSession(r *http.Request) (*models.RefreshToken, error) {
+	cookie, err := r.Cookie("refresh_token")
+	if err != nil {
+		return nil, models.ErrNoRecord
+	}
+	return app.refreshTokens.Get(r.Context(), cookie.Value)
+}
+
+// revokeCurrentAccessToken отзывает JWT из куки запроса, если он ещё действует
+func (app *application) revokeCurrentAccessToken(r *http.Request) error {
+	cookie, err := r.Cookie("auth_token")
+	if err != nil {
+		return nil
+	}
+	claims, err := app.jwtKeys.ParseClaims(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	user, _ := claims.User()
+	var userId int
+	if user != nil {
+		userId = user.ID
+	}
+	return app.revokedTokens.Revoke(r.Context(), claims.ID, userId, claims.ExpiresAt.Time)
+}
+
+// syncRevokedTokens подтягивает в память отзывы, только что записанные в БД
+// при завершении сессий. Если не вышло, они подтянутся при фоновой синхронизации
+func (app *application) syncRevokedTokens(ctx context.Context) {
+	if err := app.revokedTokens.Sync(ctx); err != nil {
+		app.logger.ErrorContext(ctx, "revoked tokens sync failed", "err", err)
+	}
+}
+
+// clearAuthCookies удаляет куки с токенами, после чего браузер становится анонимным
+func clearAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{"auth_token", "refresh_token"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   true, // если HTTPS - true, локальная разработка - false
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   -1,
+		})
+	}
+}
+
+// clientIP - адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+)
+
+// номера дескрипторов, под которыми новый процесс получает слушающие сокеты
+// от старого при перезапуске без простоя: основной и служебный (-admin-addr)
+const (
+	listenerFDEnv      = "SNIPPETBOX_LISTENER_FD"
+	adminListenerFDEnv = "SNIPPETBOX_ADMIN_LISTENER_FD"
+)
+
+// jwtSecretFDEnv - номер дескриптора канала, из которого новый процесс читает
+// случайный ключ JWT старого, если -jwt-keys не задан. Иначе после
+// перезапуска все выданные JWT перестали бы приниматься
+const jwtSecretFDEnv = "SNIPPETBOX_JWT_SECRET_FD"
+
+// listen возвращает сокет, унаследованный от предыдущего процесса через
+// переменную env, если он есть, иначе открывает новый на addr. inherited
+// говорит, что старый процесс ждёт SIGTERM, чтобы уйти
+func listen(addr, env string, getenv func(string) string) (_ net.Listener, inherited bool, err error) {
+	value := getenv(env)
+	if value == "" {
+		ln, err := net.Listen("tcp", addr)
+		return ln, false, err
+	}
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", env, err)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	if f == nil {
+		return nil, false, fmt.Errorf("%s: bad file descriptor %d", env, fd)
+	}
+	defer f.Close()
+	// FileListener дублирует дескриптор, поэтому f можно закрыть
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", env, err)
+	}
+	return ln, true, nil
+}
+
+// inheritedSecret читает ключ JWT, переданный предыдущим процессом через
+// канал из переменной env. Без переменной возвращает nil
+func inheritedSecret(env string, getenv func(string) string) ([]byte, error) {
+	value := getenv(env)
+	if value == "" {
+		return nil, nil
+	}
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", env, err)
+	}
+	f := os.NewFile(uintptr(fd), "jwt secret")
+	if f == nil {
+		return nil, fmt.Errorf("%s: bad file descriptor %d", env, fd)
+	}
+	defer f.Close()
+	secret, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", env, err)
+	}
+	return secret, nil
+}
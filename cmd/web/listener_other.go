@@ -0,0 +1,22 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// Передать слушающий сокет другому процессу можно только в unix, на других
+// системах перезапуска без простоя нет
+
+func notifyRestart(c chan<- os.Signal) {}
+
+func handoff(listeners map[string]net.Listener, jwtSecret []byte) (*os.Process, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func takeOver() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,104 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestListen(t *testing.T) {
+	ln, inherited, err := listen("127.0.0.1:0", listenerFDEnv, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	assert.Equal(t, inherited, false)
+
+	// так сокет видит новый процесс после handoff
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// listen закрывает полученный дескриптор, как в новом процессе
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	getenv := func(key string) string {
+		if key == listenerFDEnv {
+			return strconv.Itoa(fd)
+		}
+		return ""
+	}
+	taken, inherited, err := listen("ignored:0", listenerFDEnv, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	assert.Equal(t, inherited, true)
+	assert.Equal(t, taken.Addr().String(), ln.Addr().String())
+
+	// оба сокета принимают соединения из одной очереди
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	accepted, err := taken.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted.Close()
+
+	_, _, err = listen("", listenerFDEnv, func(string) string { return "three" })
+	if err == nil {
+		t.Error("expected error for a bad descriptor")
+	}
+}
+
+func TestInheritedSecret(t *testing.T) {
+	secret, err := inheritedSecret(jwtSecretFDEnv, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, secret == nil, true)
+
+	// так ключ видит новый процесс после handoff
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	defer r.Close()
+	// inheritedSecret закрывает полученный дескриптор, как в новом процессе
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	getenv := func(key string) string {
+		if key == jwtSecretFDEnv {
+			return strconv.Itoa(fd)
+		}
+		return ""
+	}
+	secret, err = inheritedSecret(jwtSecretFDEnv, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(secret), "secret")
+
+	_, err = inheritedSecret(jwtSecretFDEnv, func(string) string { return "three" })
+	if err == nil {
+		t.Error("expected error for a bad descriptor")
+	}
+}
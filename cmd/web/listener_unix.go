@@ -0,0 +1,78 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"syscall"
+)
+
+// notifyRestart подписывает c на сигналы перезапуска без простоя
+func notifyRestart(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGUSR2)
+}
+
+// handoff запускает новый экземпляр сервера с теми же аргументами и передаёт
+// ему сокеты listeners, ключ - переменная окружения, через которую новый
+// процесс найдёт сокет. Оба процесса принимают соединения из одних очередей,
+// пока новый не пришлёт SIGTERM, поэтому подключения не отвергаются.
+// Непустой jwtSecret передаётся через канал, чтобы новый процесс подписывал
+// JWT тем же случайным ключом
+func handoff(listeners map[string]net.Listener, jwtSecret []byte) (*os.Process, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	for _, env := range slices.Sorted(maps.Keys(listeners)) {
+		tcp, ok := listeners[env].(*net.TCPListener)
+		if !ok {
+			return nil, fmt.Errorf("handoff: %T can not be passed to another process", listeners[env])
+		}
+		f, err := tcp.File()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		// ExtraFiles[i] получает дескриптор 3+i
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", env, 3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+	if jwtSecret != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		// ключ меньше буфера канала, запись не ждёт читателя
+		_, err = w.Write(jwtSecret)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", jwtSecretFDEnv, 3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
+
+// takeOver сообщает старому процессу, что новый уже принимает соединения
+// и тот может завершиться
+func takeOver() error {
+	return syscall.Kill(os.Getppid(), syscall.SIGTERM)
+}
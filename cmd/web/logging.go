@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const contextKeyRequest = contextKey("request")
+
+// максимальная длина X-Request-ID, который принимается от клиента или прокси
+const maxRequestID = 64
+
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// requestInfo - то, что известно о запросе и попадает в каждую запись лога,
+// сделанную с его контекстом. Поля дописываются по мере обработки запроса
+type requestInfo struct {
+	ID     string
+	UserID int
+	Route  string
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(contextKeyRequest).(*requestInfo)
+	return info
+}
+
+// requestID возвращает ID запроса r, если он уже присвоен
+func requestID(r *http.Request) string {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// newLogger создаёт логгер, пишущий в w в формате format (text или json)
+// записи не ниже level
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// contextHandler добавляет к записи request_id, user_id, route и trace_id
+// из контекста, переданного в InfoContext, ErrorContext и т.д.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if info := requestInfoFrom(ctx); info != nil {
+		rec.AddAttrs(slog.String("request_id", info.ID))
+		if info.UserID > 0 {
+			rec.AddAttrs(slog.Int("user_id", info.UserID))
+		}
+		if info.Route != "" {
+			rec.AddAttrs(slog.String("route", info.Route))
+		}
+	}
+	// по trace_id запись находится рядом с трейсом запроса
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		rec.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// assignRequestID присваивает запросу ID и возвращает его в X-Request-ID.
+// ID от прокси перед приложением сохраняется, если выглядит безопасно,
+// чтобы записи обоих логов можно было сопоставить
+func (app *application) assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if len(id) > maxRequestID || !requestIDRX.MatchString(id) {
+			id = rand.Text()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), contextKeyRequest, &requestInfo{ID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tagRoute записывает в requestInfo шаблон маршрута, который обработает
+// запрос, - по нему удобнее искать в логах, чем по URL с параметрами
+func tagRoute(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := requestInfoFrom(r.Context()); info != nil {
+			_, info.Route = mux.Handler(r)
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -1,58 +1,163 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"database/sql"
+	"errors"
 	"flag"
 	"html/template"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	_ "github.com/lib/pq"
+	"snippetbox.glebich/internal/config"
+	"snippetbox.glebich/internal/jwtAuth"
+	"snippetbox.glebich/internal/migrate"
 	"snippetbox.glebich/internal/models"
+	"snippetbox.glebich/migrations"
 )
 
 type application struct {
-	errorLog      *log.Logger
-	infoLog       *log.Logger
-	snippets      *models.SnippetModel
-	users         *models.UserModel
-	refreshTokens *models.RefreshTokenModel
+	logger        *slog.Logger
+	accessLog     *accessLog
+	metrics       *metrics
+	readiness     *readiness
+	snippets      models.SnippetModelInterface
+	users         models.UserModelInterface
+	refreshTokens models.RefreshTokenModelInterface
+	revokedTokens models.RevokedTokenModelInterface
+	jwtKeys       *jwtAuth.Keyring
+	clientSecret  string
 	templateCache map[string]*template.Template
+	pageSize      int
+	sessionDays   int
 }
 
 func main() {
 
-	// для того, чтобы передавать флаги через CLI типа - go run ./cmd/web -addr=":8000"
-	addr := flag.String("addr", ":8000", "HTTP network address")
-	flag.Parse()
+	// настройки из флагов, переменных окружения и YAML файла - см. internal/config
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	infoLog := log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "[ERROR]\t", log.Ldate|log.Ltime|log.Lshortfile)
+	logger, err := newLogger(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// fatal - замена log.Fatal: у slog её нет
+	fatal := func(msg string, err error) {
+		logger.Error(msg, "err", err)
+		os.Exit(1)
+	}
+	shutdownTracing, err := setupTracing(context.Background(), cfg.TraceExporter, cfg.TraceEndpoint, cfg.TraceFile, cfg.TraceSample)
+	if err != nil {
+		fatal("tracing setup failed", err)
+	}
+	accessLog, err := newAccessLog(os.Stdout, cfg.AccessLog, cfg.AccessLogSample, cfg.AccessLogExclude)
+	if err != nil {
+		fatal("access log", err)
+	}
 
-	// Часть с подключением к БД
-	dsn := "postgres://postgres:postgres@db:5432/snippetbox?sslmode=disable"
-	db, err := openDB(dsn)
+	// Часть с подключением к БД - драйвер выбирается по схеме DSN
+	db, dialect, err := models.OpenDB(cfg.DSN)
 	if err != nil {
-		errorLog.Fatal(err)
+		fatal("opening database failed", err)
 	}
 	defer db.Close()
 
+	migrationFiles, err := migrations.FS(string(dialect))
+	if err != nil {
+		fatal("loading migrations failed", err)
+	}
+	migrator, err := migrate.New(db, string(dialect), migrationFiles)
+	if err != nil {
+		fatal("loading migrations failed", err)
+	}
+	if cfg.Migrate {
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			logger.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			fatal("migration failed", err)
+		}
+	} else {
+		pending, err := migrator.Pending()
+		if err != nil {
+			fatal("checking migrations failed", err)
+		}
+		if len(pending) > 0 {
+			logger.Warn("database migrations are pending, run ./cmd/migrate up or start with -migrate", "pending", len(pending))
+		}
+	}
+
+	// ключи JWT: без файла каждый запуск получает новый случайный ключ,
+	// и все выданные раньше JWT перестают приниматься. Процесс, запущенный
+	// перезапуском без простоя, получает ключ от старого
+	var jwtKeys *jwtAuth.Keyring
+	var jwtSecret []byte
+	if cfg.JWTKeys != "" {
+		jwtKeys, err = jwtAuth.LoadKeyring(cfg.JWTKeys)
+	} else {
+		jwtSecret, err = inheritedSecret(jwtSecretFDEnv, os.Getenv)
+		if err == nil && jwtSecret == nil {
+			logger.Warn("no -jwt-keys given, signing JWTs with a random key: they are rejected after a restart and by other instances")
+			jwtSecret, err = jwtAuth.EphemeralSecret()
+		}
+		if err == nil {
+			jwtKeys, err = jwtAuth.EphemeralKeyring(jwtSecret)
+		}
+	}
+	if err != nil {
+		fatal("loading JWT keys failed", err)
+	}
+	jwtKeys.Issuer = cfg.JWTIssuer
+	jwtKeys.Audience = cfg.JWTAudience
+	jwtKeys.TTL = cfg.AccessTokenTTL
+
+	// отозванные access токены проверяются по памяти, загружаю их до старта:
+	// с пустым списком сервер принимал бы отозванные токены до следующего Sync
+	revokedTokens := &models.RevokedTokenModel{DB: db, Timeout: cfg.DBTimeout}
+	if err = revokedTokens.Sync(context.Background()); err != nil {
+		fatal("loading revoked tokens failed", err)
+	}
+
 	// создаю новый темплейт кэш
 	templateCache, err := newTemplateCache()
 	if err != nil {
-		errorLog.Fatal(err)
+		fatal("loading templates failed", err)
 	}
 
 	app := &application{
-		infoLog:       infoLog,
-		errorLog:      errorLog,
-		snippets:      &models.SnippetModel{DB: db},
-		users:         &models.UserModel{DB: db},
-		refreshTokens: &models.RefreshTokenModel{DB: db},
+		logger:        logger,
+		accessLog:     accessLog,
+		metrics:       newMetrics(db),
+		readiness:     &readiness{db: db, migrations: migrator},
+		snippets:      &models.SnippetModel{DB: db, Dialect: dialect, Timeout: cfg.DBTimeout},
+		users:         &models.UserModel{DB: db, Timeout: cfg.DBTimeout},
+		refreshTokens: &models.RefreshTokenModel{DB: db, Timeout: cfg.DBTimeout},
+		revokedTokens: revokedTokens,
+		jwtKeys:       jwtKeys,
+		clientSecret:  cfg.IntrospectSecret,
 		templateCache: templateCache,
+		pageSize:      cfg.PageSize,
+		sessionDays:   cfg.SessionDays,
 	}
 
 	tlsConfig := &tls.Config{
@@ -62,33 +167,160 @@ func main() {
 	// мини настройка веб-сервера - адрес порта, поток записи ошибок и
 	// глобальный обработчик запросов
 	srv := &http.Server{
-		Addr:         *addr,
-		ErrorLog:     errorLog,
+		Addr:         cfg.Addr,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		Handler:      app.routes(),
 		TLSConfig:    tlsConfig,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.IdleTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
 	}
 
-	// просто информационное сообщение о запуске сервера
-	infoLog.Printf("Starting server on %s", *addr)
-	// запуск прослушивания порта - на этом шаге программа останавливается (не завершается),
-	// пока не упадет сервер
-	// (начало работы сервера)
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	// в случае сбоя работы сервера программа завершается
-	// выводится ошибка и os.Exit(1)
-	errorLog.Fatal(err)
-}
+	// ctx отменяется по Ctrl+C или SIGTERM (его же присылает новый процесс
+	// после перезапуска), после чего сервер дорабатывает начатые запросы
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// SIGHUP и SIGUSR2 - перезапуск: сокет передаётся новому процессу
+	restart := make(chan os.Signal, 1)
+	notifyRestart(restart)
+
+	// фоновые задачи останавливаются после того, как сервер обработал
+	// последний запрос: отзывы токенов нужны, пока запросы ещё идут
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var background sync.WaitGroup
+	if cfg.ReapInterval > 0 {
+		reaper := &models.Reaper{DB: db, Dialect: dialect, Timeout: cfg.DBTimeout, BatchSize: cfg.ReapBatch}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			app.reap(workers, reaper, cfg.ReapInterval)
+		}()
+	}
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", dsn)
+	if cfg.RevocationSync > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			app.syncRevoked(workers, cfg.RevocationSync)
+		}()
+	}
+
+	ln, inherited, err := listen(cfg.Addr, listenerFDEnv, os.Getenv)
 	if err != nil {
-		return nil, err
+		fatal("listen failed", err)
+	}
+	listeners := map[string]net.Listener{listenerFDEnv: ln}
+	// просто информационное сообщение о запуске сервера
+	logger.Info("starting server", "addr", ln.Addr().String())
+	// запуск сервера в отдельной горутине, чтобы main мог дождаться сигнала
+	// на завершение
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- srv.ServeTLS(ln, cfg.TLSCert, cfg.TLSKey)
+	}()
+
+	// служебный сервер без TLS для Prometheus, наружу его открывать не нужно
+	var adminSrv *http.Server
+	if cfg.AdminAddr != "" {
+		adminLn, _, err := listen(cfg.AdminAddr, adminListenerFDEnv, os.Getenv)
+		if err != nil {
+			fatal("admin listen failed", err)
+		}
+		listeners[adminListenerFDEnv] = adminLn
+		adminSrv = &http.Server{
+			ErrorLog:     srv.ErrorLog,
+			Handler:      app.adminRoutes(),
+			IdleTimeout:  cfg.IdleTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		}
+		logger.Info("starting admin server", "addr", adminLn.Addr().String())
+		go func() {
+			serverErr <- adminSrv.Serve(adminLn)
+		}()
 	}
-	if err = db.Ping(); err != nil {
-		return nil, err
+	if inherited {
+		logger.Info("took over the listener, stopping the previous process")
+		if err = takeOver(); err != nil {
+			logger.Error("take over failed", "err", err)
+		}
+	}
+
+	var serveErr error
+	// child - запущенный при перезапуске процесс, пока он не забрал сокет или
+	// не завершился. Второй процесс в это время не запускается: каждый из них
+	// остановил бы этот, а лишние так и остались бы работать
+	var child *os.Process
+	childExited := make(chan struct{}, 1)
+wait:
+	for {
+		select {
+		case serveErr = <-serverErr:
+			break wait
+		case <-ctx.Done():
+			break wait
+		case <-restart:
+			if child != nil {
+				logger.Warn("restart already in progress, signal ignored", "pid", child.Pid)
+				continue
+			}
+			child, err = handoff(listeners, jwtSecret)
+			if err != nil {
+				logger.Error("restart failed", "err", err)
+				child = nil
+				continue
+			}
+			logger.Info("restart: started new process, serving until it takes over", "pid", child.Pid)
+			// если новый процесс не поднялся, продолжаю работать
+			go func(child *os.Process) {
+				state, err := child.Wait()
+				if err != nil {
+					logger.Error("restart failed", "err", err)
+				} else {
+					logger.Error("restart: new process exited, still serving", "pid", child.Pid, "state", state.String())
+				}
+				childExited <- struct{}{}
+			}(child)
+		case <-childExited:
+			child = nil
+		}
+	}
+
+	// readyz отвечает 503, а сервер ещё drain-delay принимает запросы: иначе
+	// балансировщик узнал бы об остановке только по отказам в соединении
+	app.readiness.draining.Store(true)
+	if serveErr == nil && cfg.DrainDelay > 0 {
+		// повторный Ctrl+C или SIGTERM завершает процесс, не дожидаясь
+		stop()
+		logger.Info("draining, shutting down after delay", "delay", cfg.DrainDelay)
+		time.Sleep(cfg.DrainDelay)
+	}
+
+	logger.Info("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		// не успевшие за shutdown-timeout соединения обрываются
+		logger.Warn("shutdown timed out, closing remaining connections", "err", err)
+		srv.Close()
+	}
+	// метрики доступны, пока основной сервер дорабатывает запросы
+	if adminSrv != nil {
+		adminSrv.Shutdown(shutdownCtx)
+	}
+	stopWorkers()
+	background.Wait()
+	// отправляю спаны, накопленные в батче
+	if err = shutdownTracing(shutdownCtx); err != nil {
+		logger.Warn("flushing traces failed", "err", err)
+	}
+
+	if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		// в случае сбоя работы сервера программа завершается с ошибкой,
+		// но сначала закрывает БД
+		db.Close()
+		fatal("server failed", serveErr)
 	}
-	return db, nil
+	logger.Info("server stopped")
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// исходы проверки входа в authenticate
+const (
+	authOK        = "ok"        // JWT принят
+	authRefreshed = "refreshed" // JWT выдан заново по refresh токену
+	authRejected  = "rejected"  // оба токена недействительны, запрос анонимный
+	authError     = "error"     // проверить не удалось, например БД не ответила
+)
+
+// metrics - метрики приложения для Prometheus. Регистрируются в своём
+// реестре, а не в глобальном, чтобы тесты могли создавать их заново
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	renderDuration  *prometheus.HistogramVec
+	auth            *prometheus.CounterVec
+	snippetsCreated prometheus.Counter
+}
+
+// newMetrics создаёт метрики. Если db не nil, публикуется и статистика пула
+// соединений (sql.DBStats)
+func newMetrics(db *sql.DB) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_http_requests_total",
+			Help: "HTTP requests by route pattern and status code.",
+		}, []string{"route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snippetbox_http_request_duration_seconds",
+			Help:    "Time spent handling HTTP requests by route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+		renderDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snippetbox_template_render_duration_seconds",
+			Help:    "Time spent executing page templates.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1},
+		}, []string{"page"}),
+		auth: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_auth_total",
+			Help: "Outcomes of authenticating requests with a session: ok, refreshed, rejected or error.",
+		}, []string{"outcome"}),
+		snippetsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snippetbox_snippets_created_total",
+			Help: "Snippets created.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests, m.requestDuration, m.renderDuration, m.auth, m.snippetsCreated,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "snippetbox"))
+	}
+	return m
+}
+
+// handler отдаёт метрики в формате Prometheus
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// instrument считает запросы и время их обработки по шаблону маршрута.
+// Запросы, для которых маршрута нет, попадают в route="none", чтобы
+// сканеры не плодили по серии на каждый URL
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			route := "none"
+			if info := requestInfoFrom(r.Context()); info != nil && info.Route != "" {
+				route = info.Route
+			}
+			app.metrics.requests.WithLabelValues(route, strconv.Itoa(rec.status)).Inc()
+			app.metrics.requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// adminRoutes - обработчики служебного адреса -admin-addr, закрытого от
+// пользователей
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", app.metrics.handler())
+	mux.HandleFunc("GET /healthz", app.healthz)
+	mux.HandleFunc("GET /readyz", app.readyzDetail)
+	return mux
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+
+	form := url.Values{}
+	form.Add("title", "O snail")
+	form.Add("content", "Climb Mount Fuji")
+	form.Add("expires", "7")
+	form.Add("csrf_token", ts.csrfToken(t, "/snippet/create"))
+	code, _, _ := ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	ts.get(t, "/snippet/view/1")
+	ts.get(t, "/no/such/page")
+
+	// JWT истёк - следующий запрос обменивает refresh токен
+	serverURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar.SetCookies(serverURL, []*http.Cookie{{Name: "auth_token", Path: "/", MaxAge: -1}})
+	ts.get(t, "/")
+
+	rr := httptest.NewRecorder()
+	app.adminRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, rr.Code, http.StatusOK)
+	body, err := io.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := string(body)
+
+	for _, want := range []string{
+		`snippetbox_http_requests_total{code="303",route="POST /snippet/create"} 1`,
+		`snippetbox_http_requests_total{code="200",route="GET /snippet/view/{id}"} 1`,
+		`snippetbox_http_requests_total{code="404",route="GET /"} 1`,
+		`snippetbox_http_request_duration_seconds_count{route="GET /snippet/view/{id}"} 1`,
+		`snippetbox_template_render_duration_seconds_count{page="view.html"} 1`,
+		`snippetbox_auth_total{outcome="refreshed"} 1`,
+		`snippetbox_snippets_created_total 1`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+	assert.Equal(t, strings.Contains(metrics, `outcome="ok"`), true)
+	assert.Equal(t, strings.Contains(metrics, "/no/such/page"), false)
+}
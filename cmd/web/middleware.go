@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"runtime/debug"
 
 	"github.com/justinas/nosurf"
 	"snippetbox.glebich/internal/jwtAuth"
@@ -26,20 +27,14 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) logRequest(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverError(w, fmt.Errorf("%s", err))
+				// при панике место ошибки знает только стек
+				app.logger.ErrorContext(r.Context(), "panic", "err", fmt.Sprint(err), "method", r.Method, "uri", r.URL.RequestURI(), "stack", string(debug.Stack()))
+				app.errorPage(w, r, http.StatusInternalServerError)
 			}
 		}()
 
@@ -59,31 +54,47 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token, err := r.Cookie("auth_token")
 		if err != nil {
-			user, err = app.VerifyRefreshTokenAndCreateJWT(refreshToken.Value, w)
+			user, err = app.VerifyRefreshTokenAndCreateJWT(w, r, refreshToken.Value)
 			if err != nil {
 				if errors.Is(err, jwtAuth.ErrInvalidRefreshToken) {
+					app.metrics.auth.WithLabelValues(authRejected).Inc()
 					next.ServeHTTP(w, r)
 					return
 				}
-				if errors.Is(err, jwtAuth.ErrServerError) {
-					app.serverError(w, err)
+				if errors.Is(err, jwtAuth.ErrServerError) || errors.Is(err, context.DeadlineExceeded) {
+					app.metrics.auth.WithLabelValues(authError).Inc()
+					app.serverError(w, r, err)
 					return
 				} else {
+					app.metrics.auth.WithLabelValues(authRejected).Inc()
 					next.ServeHTTP(w, r)
 					return
 				}
 			}
+			app.metrics.auth.WithLabelValues(authRefreshed).Inc()
 		} else {
-			user, err = jwtAuth.VerifyJWTToken(token.Value)
+			user, err = app.verifyAccessToken(token.Value)
 			if err != nil {
-				user, err = app.VerifyRefreshTokenAndCreateJWT(refreshToken.Value, w)
+				user, err = app.VerifyRefreshTokenAndCreateJWT(w, r, refreshToken.Value)
 				if err != nil {
+					if errors.Is(err, context.DeadlineExceeded) {
+						app.metrics.auth.WithLabelValues(authError).Inc()
+						app.serverError(w, r, err)
+						return
+					}
+					app.metrics.auth.WithLabelValues(authRejected).Inc()
 					next.ServeHTTP(w, r) // подробные ошибки добавить
 					return
 				}
+				app.metrics.auth.WithLabelValues(authRefreshed).Inc()
+			} else {
+				app.metrics.auth.WithLabelValues(authOK).Inc()
 			}
 		}
 
+		if info := requestInfoFrom(r.Context()); info != nil {
+			info.UserID = user.ID
+		}
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -104,6 +115,18 @@ func (app *application) requireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdmin пускает только пользователей с ролью admin. Ставится после requireAuth
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authenticatedUser(r).HasRole("admin") {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requireNoAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, ok := r.Context().Value(contextKeyUser).(*jwtAuth.Sub)
@@ -123,6 +146,11 @@ func (app *application) noSurf(next http.Handler) http.Handler {
 		Path:     "/",
 		Secure:   true,
 	})
+	// интроспекцию вызывают сервисы, а не браузер, - у них нет CSRF куки
+	csrfHandler.ExemptPath("/oauth/introspect")
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.clientError(w, r, http.StatusBadRequest)
+	}))
 
 	return csrfHandler
 }
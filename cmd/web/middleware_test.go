@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 
 	"snippetbox.glebich/internal/assert"
@@ -45,3 +48,200 @@ func TestSecureHeaders(t *testing.T) {
 	bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestAssignRequestID(t *testing.T) {
+	app := newTestApplication(t)
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "Generated", header: "", keep: false},
+		{name: "From proxy", header: "edge-7f3a.42", keep: true},
+		{name: "Unsafe", header: "id\"><script>", keep: false},
+		{name: "Too long", header: strings.Repeat("a", maxRequestID+1), keep: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			app.assignRequestID(next).ServeHTTP(rr, r)
+
+			id := rr.Result().Header.Get("X-Request-ID")
+			assert.Equal(t, id, seen)
+			assert.Equal(t, id == tt.header, tt.keep)
+			assert.Equal(t, id != "", true)
+		})
+	}
+}
+
+func TestRequestLogAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApplication(t)
+	app.logger = logger
+	app.snippets = slowSnippets{app.snippets}
+	ts := newTestServer(t, app.routes())
+	ts.signup(t, "alice", "alice@example.com", "Pa$$w0rd")
+	buf.Reset()
+
+	_, header, _ := ts.get(t, "/snippet/view/1")
+	id := header.Get("X-Request-ID")
+
+	var entry struct {
+		Level     string `json:"level"`
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		UserID    int    `json:"user_id"`
+		Route     string `json:"route"`
+		Source    string `json:"source"`
+	}
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, entry.RequestID, id)
+		if entry.Msg == "server error" {
+			found = true
+			assert.Equal(t, entry.Level, "ERROR")
+			assert.Equal(t, entry.UserID, 1)
+			assert.Equal(t, entry.Route, "GET /snippet/view/{id}")
+			assert.Equal(t, strings.HasPrefix(entry.Source, "handlers.go:"), true)
+		}
+	}
+	assert.Equal(t, found, true)
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "text", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	assert.Equal(t, strings.Contains(buf.String(), "hidden"), false)
+	assert.Equal(t, strings.Contains(buf.String(), "msg=shown"), true)
+
+	_, err = newLogger(&buf, "xml", "info")
+	assert.Equal(t, err != nil, true)
+	_, err = newLogger(&buf, "json", "loud")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestLogRequest(t *testing.T) {
+	handler := func(status int, body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// так пользователя отмечает authenticate
+			requestInfoFrom(r.Context()).UserID = 7
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		})
+	}
+	serve := func(t *testing.T, l *accessLog, path string, next http.Handler) {
+		t.Helper()
+
+		app := newTestApplication(t)
+		app.accessLog = l
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("User-Agent", "curl/8.5")
+		app.assignRequestID(app.logRequest(next)).ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	t.Run("Combined", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newAccessLog(&buf, "combined", 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, l, "/snippet/view/1?x=1", handler(http.StatusTeapot, "short and stout"))
+
+		rx := regexp.MustCompile(`^192\.0\.2\.1 - 7 \[[^]]+\] "GET /snippet/view/1\?x=1 HTTP/1\.1" 418 15 "" "curl/8\.5" \d+\n$`)
+		assert.Equal(t, rx.MatchString(buf.String()), true)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newAccessLog(&buf, "json", 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, l, "/", handler(http.StatusOK, "OK"))
+
+		var entry struct {
+			Msg       string `json:"msg"`
+			Status    int    `json:"status"`
+			Bytes     int    `json:"bytes"`
+			UserID    int    `json:"user_id"`
+			RequestID string `json:"request_id"`
+			UserAgent string `json:"user_agent"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, entry.Msg, "access")
+		assert.Equal(t, entry.Status, http.StatusOK)
+		assert.Equal(t, entry.Bytes, 2)
+		assert.Equal(t, entry.UserID, 7)
+		assert.Equal(t, entry.RequestID != "", true)
+		assert.Equal(t, entry.UserAgent, "curl/8.5")
+	})
+
+	t.Run("Excluded path", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newAccessLog(&buf, "combined", 1, []string{"/static/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, l, "/static/css/main.css", handler(http.StatusOK, "body{}"))
+		assert.Equal(t, buf.Len(), 0)
+	})
+
+	t.Run("Sampling keeps server errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newAccessLog(&buf, "combined", 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, l, "/", handler(http.StatusOK, "OK"))
+		assert.Equal(t, buf.Len(), 0)
+
+		serve(t, l, "/", handler(http.StatusInternalServerError, "oops"))
+		assert.Equal(t, strings.Contains(buf.String(), `" 500 4 `), true)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newAccessLog(&buf, "combined", 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := newTestApplication(t)
+		app.accessLog = l
+		ts := newTestServer(t, app.routes())
+		app.snippets = nil // паника в обработчике
+		ts.get(t, "/snippet/view/1")
+		assert.Equal(t, strings.Contains(buf.String(), `"GET /snippet/view/1 HTTP/1.1" 500 `), true)
+	})
+
+	t.Run("Off", func(t *testing.T) {
+		l, err := newAccessLog(io.Discard, "off", 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, l == nil, true)
+	})
+}
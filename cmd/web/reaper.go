@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"snippetbox.glebich/internal/models"
+)
+
+// reap раз в interval удаляет из БД истекшие сниппеты и токены,
+// пока не отменён ctx. Первый проход выполняется сразу после запуска
+func (app *application) reap(ctx context.Context, reaper *models.Reaper, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := reaper.Reap(ctx)
+		if result != (models.ReapResult{}) {
+			app.logger.Info("reaper purged expired rows", "snippets", result.Snippets, "refresh_tokens", result.RefreshTokens,
+				"access_tokens", result.AccessTokens, "revoked_tokens", result.RevokedTokens, "token_versions", result.TokenVersions)
+		}
+		// ErrLocked - значит, очисткой сейчас занят другой экземпляр
+		if err != nil && !errors.Is(err, models.ErrLocked) && ctx.Err() == nil {
+			app.logger.Error("reaper failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// syncRevoked раз в interval подтягивает из БД access токены, отозванные
+// другими экземплярами приложения, пока не отменён ctx
+func (app *application) syncRevoked(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := app.revokedTokens.Sync(ctx); err != nil && ctx.Err() == nil {
+			app.logger.Error("revoked tokens sync failed", "err", err)
+		}
+	}
+}
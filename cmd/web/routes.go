@@ -25,11 +25,35 @@ func (app *application) routes() http.Handler {
 
 	mux.HandleFunc("GET /", app.home)
 	mux.HandleFunc("GET /snippet/view/{id}", app.snippetView)
+	mux.HandleFunc("GET /search", app.search)
+	mux.HandleFunc("GET /tag/{name}", app.tagView)
+
+	// для других сервисов, которые доверяют входу через snippetbox
+	mux.HandleFunc("GET /.well-known/jwks.json", app.jwks)
+	if app.clientSecret != "" {
+		mux.HandleFunc("POST /oauth/introspect", app.introspect)
+	}
 
 	protected := alice.New(app.requireAuth)
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
 	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreateGet))
 	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	mux.Handle("GET /snippet/edit/{id}", protected.ThenFunc(app.snippetEditGet))
+	mux.Handle("POST /snippet/edit/{id}", protected.ThenFunc(app.snippetEditPost))
+	mux.Handle("POST /snippet/delete/{id}", protected.ThenFunc(app.snippetDeletePost))
+	mux.Handle("POST /snippet/restore/{id}", protected.ThenFunc(app.snippetRestorePost))
+	mux.Handle("POST /snippet/purge/{id}", protected.ThenFunc(app.snippetPurgePost))
+	mux.Handle("GET /user/snippets", protected.ThenFunc(app.userSnippets))
+	mux.Handle("GET /user/trash", protected.ThenFunc(app.userTrash))
+	mux.Handle("GET /user/password", protected.ThenFunc(app.userPasswordGet))
+	mux.Handle("POST /user/password", protected.ThenFunc(app.userPasswordPost))
+	mux.Handle("GET /user/sessions", protected.ThenFunc(app.userSessions))
+	mux.Handle("POST /user/sessions/revoke/{id}", protected.ThenFunc(app.sessionRevokePost))
+	mux.Handle("POST /user/sessions/revoke-others", protected.ThenFunc(app.sessionRevokeOthersPost))
+
+	admin := protected.Append(app.requireAdmin)
+	mux.Handle("GET /admin/tokens", admin.ThenFunc(app.adminTokens))
+	mux.Handle("POST /admin/tokens/revoke", admin.ThenFunc(app.adminRevokePost))
 
 	altProtected := alice.New(app.requireNoAuth)
 	mux.Handle("GET /user/signup", altProtected.ThenFunc(app.userSignupGet))
@@ -40,7 +64,17 @@ func (app *application) routes() http.Handler {
 	// noSurf глобально, так как лог аут находится в нав баре, можно выйти из любой страницы,
 	// так что нужно везде вставлять csrf токен в куки
 	// может, только для файл сервера не надо
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders, app.authenticate, app.noSurf)
+	// assignRequestID первым, чтобы ID был и в записях о панике, logRequest
+	// снаружи recoverPanic, чтобы в журнал попал ответ 500 после паники.
+	// traceRequest до остальных, чтобы их время тоже попало в спан запроса
+	standard := alice.New(app.assignRequestID, app.traceRequest, app.instrument, app.logRequest, app.recoverPanic, secureHeaders, app.authenticate, app.noSurf)
+
+	// проверки для оркестратора идут мимо цепочки: им не нужны CSRF, вход
+	// и запись в журнал запросов, который они бы засоряли каждые пару секунд
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", app.healthz)
+	root.HandleFunc("GET /readyz", app.readyz)
+	root.Handle("/", standard.Then(tagRoute(mux)))
 
-	return standard.Then(mux)
+	return root
 }
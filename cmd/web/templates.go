@@ -1,9 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"snippetbox.glebich/internal/jwtAuth"
@@ -12,23 +14,69 @@ import (
 )
 
 type templateData struct {
-	CurrentYear int
-	Snippet     *models.Snippet
-	Snippets    []*models.Snippet
-	Form        any
-	User        *jwtAuth.Sub
-	CSRFToken   string
+	CurrentYear    int
+	Snippet        *models.Snippet
+	Snippets       []*models.Snippet
+	Revisions      []*models.Revision
+	SearchResults  []*models.SearchResult
+	Query          string
+	Tag            string
+	TagCloud       []*models.TagCount
+	NextURL        string
+	PrevURL        string
+	ActiveCount    int
+	ExpiredCount   int
+	Sessions       []*models.RefreshToken
+	CurrentSession int
+	RevokedTokens  []*models.RevokedToken
+	Form           any
+	User           *jwtAuth.Sub
+	CSRFToken      string
+}
+
+// setPage кладёт в данные шаблона страницу сниппетов и ссылки
+// на соседние страницы относительно path
+func (td *templateData) setPage(page *models.SnippetPage, path string) {
+	td.Snippets = page.Snippets
+	if page.Next > 0 {
+		td.NextURL = fmt.Sprintf("%s?after=%d", path, page.Next)
+	}
+	if page.Prev > 0 {
+		td.PrevURL = fmt.Sprintf("%s?before=%d", path, page.Prev)
+	}
 }
 
 var functions = template.FuncMap{
 	"humanDate": humanDate,
 	"timeNow":   timeNow,
+	"expired":   expired,
+	"purgeDate": purgeDate,
+	"highlight": highlight,
+	"tagURL":    tagURL,
+}
+
+// highlight экранирует фрагмент, найденный поиском, и заменяет маркеры
+// совпадений на <mark>
+func highlight(headline string) template.HTML {
+	escaped := template.HTMLEscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, models.HighlightStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, models.HighlightStop, "</mark>")
+	return template.HTML(escaped)
 }
 
 func timeNow(t time.Time) bool {
 	return time.Since(t) < time.Second
 }
 
+func expired(t time.Time) bool {
+	return !t.After(time.Now())
+}
+
+// purgeDate - момент, после которого удалённый сниппет уже нельзя восстановить
+func purgeDate(deleted time.Time) time.Time {
+	return deleted.AddDate(0, 0, models.TrashRetention)
+}
+
 func humanDate(t time.Time) string {
 	if t.IsZero() {
 		return ""
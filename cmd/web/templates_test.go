@@ -1,10 +1,12 @@
 package main
 
 import (
+	"html/template"
 	"testing"
 	"time"
 
 	"snippetbox.glebich/internal/assert"
+	"snippetbox.glebich/internal/models"
 )
 
 func TestHumanDate(t *testing.T) {
@@ -37,6 +39,54 @@ func TestHumanDate(t *testing.T) {
 	}
 }
 
+func TestExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		tm   time.Time
+		want bool
+	}{
+		{
+			name: "Past",
+			tm:   time.Now().Add(-time.Hour),
+			want: true,
+		},
+		{
+			name: "Future",
+			tm:   time.Now().Add(time.Hour),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, expired(tt.tm), tt.want)
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     template.HTML
+	}{
+		{
+			name:     "Match",
+			headline: "select " + models.HighlightStart + "docker" + models.HighlightStop + " images",
+			want:     "select <mark>docker</mark> images",
+		},
+		{
+			name:     "Escaped",
+			headline: "<script>" + models.HighlightStart + "alert" + models.HighlightStop + "</script>",
+			want:     "&lt;script&gt;<mark>alert</mark>&lt;/script&gt;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, highlight(tt.headline), tt.want)
+		})
+	}
+}
+
 /*
 func TestHumanDate(t *testing.T) {
 	tm := time.Date(2025, 5, 25, 15, 30, 0, 0, time.UTC)
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"snippetbox.glebich/internal/jwtAuth"
+	"snippetbox.glebich/internal/models/mocks"
+)
+
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+)'>`)
+
+func extractCSRFToken(t *testing.T, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+	return html.UnescapeString(matches[1])
+}
+
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := jwtAuth.EphemeralSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtKeys, err := jwtAuth.EphemeralKeyring(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := mocks.NewUserModel()
+	revokedTokens := mocks.NewRevokedTokenModel()
+	return &application{
+		logger:        slog.New(slog.DiscardHandler),
+		metrics:       newMetrics(nil),
+		readiness:     &readiness{db: stubPinger{}, migrations: stubMigrations{upToDate: true}},
+		snippets:      mocks.NewSnippetModel(),
+		users:         users,
+		refreshTokens: mocks.NewRefreshTokenModel(users, revokedTokens),
+		revokedTokens: revokedTokens,
+		jwtKeys:       jwtKeys,
+		templateCache: templateCache,
+		pageSize:      10,
+		sessionDays:   1,
+	}
+}
+
+// stubPinger и stubMigrations заменяют БД в проверке готовности
+type stubPinger struct {
+	err error
+}
+
+func (p stubPinger) PingContext(ctx context.Context) error {
+	return p.err
+}
+
+type stubMigrations struct {
+	upToDate bool
+	err      error
+}
+
+func (m stubMigrations) UpToDate(ctx context.Context) (bool, error) {
+	return m.upToDate, m.err
+}
+
+type testServer struct {
+	*httptest.Server
+}
+
+// newTestServer запускает HTTPS сервер, потому что все куки приложения Secure,
+// и клиент с cookie jar, который не ходит по редиректам сам
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &testServer{ts}
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.Client().Get(ts.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readResponse(t, rs)
+}
+
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// nosurf сверяет Origin с адресом сервера, браузер отправляет его сам
+	req.Header.Set("Origin", ts.URL)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readResponse(t, rs)
+}
+
+// cookie возвращает значение куки name из cookie jar клиента
+func (ts *testServer) cookie(t *testing.T, name string) string {
+	t.Helper()
+
+	serverURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range ts.Client().Jar.Cookies(serverURL) {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// csrfToken открывает страницу urlPath и достаёт из формы csrf токен
+func (ts *testServer) csrfToken(t *testing.T, urlPath string) string {
+	t.Helper()
+
+	_, _, body := ts.get(t, urlPath)
+	return extractCSRFToken(t, body)
+}
+
+// signup регистрирует пользователя, после чего клиент остаётся залогинен
+func (ts *testServer) signup(t *testing.T, name, email, password string) {
+	t.Helper()
+
+	form := url.Values{}
+	form.Add("name", name)
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", ts.csrfToken(t, "/user/signup"))
+
+	code, _, _ := ts.postForm(t, "/user/signup", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("signup failed with status %d", code)
+	}
+}
+
+func readResponse(t *testing.T, rs *http.Response) (int, http.Header, string) {
+	t.Helper()
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = bytes.TrimSpace(body)
+	return rs.StatusCode, rs.Header, string(body)
+}
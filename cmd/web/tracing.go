@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "snippetbox.glebich/cmd/web"
+
+// setupTracing настраивает глобальный TracerProvider, которым пользуются
+// и обработчики, и internal/models. exporter:
+//
+//	none   - спаны не записываются, но контекст из traceparent всё равно принимается
+//	otlp   - OTLP по HTTP на endpoint (пусто - OTEL_EXPORTER_OTLP_ENDPOINT или localhost:4318)
+//	stdout - JSON в stdout
+//	file   - JSON в file, по спану на строку
+//
+// Возвращаемая функция дописывает накопленные спаны и закрывает file, её нужно
+// вызвать при выходе
+func setupTracing(ctx context.Context, exporter, endpoint, file string, sample float64) (func(context.Context) error, error) {
+	// W3C trace context: запрос продолжает трейс прокси или другого сервиса
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		spanExporter sdktrace.SpanExporter
+		out          *os.File // file, закрывается после спанов
+		err          error
+	)
+	switch exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		spanExporter, err = otlptracehttp.New(ctx, opts...)
+	case "stdout":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "file":
+		out, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	var res *resource.Resource
+	if err == nil {
+		res, err = resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("snippetbox")))
+	}
+	if err != nil {
+		if out != nil {
+			out.Close()
+		}
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		// решение о записи принимает тот, кто начал трейс, - иначе трейс рвётся
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sample))),
+	)
+	otel.SetTracerProvider(provider)
+	if out == nil {
+		return provider.Shutdown, nil
+	}
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), out.Close())
+	}, nil
+}
+
+// traceRequest открывает спан на весь запрос. Имя спана - шаблон маршрута,
+// он известен только после tagRoute, поэтому выставляется в конце
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(clientIP(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+		if info := requestInfoFrom(ctx); info != nil {
+			span.SetAttributes(attribute.String("request_id", info.ID))
+			if info.Route != "" {
+				span.SetName(info.Route)
+				span.SetAttributes(semconv.HTTPRoute(info.Route))
+			}
+			if info.UserID > 0 {
+				span.SetAttributes(semconv.EnduserID(strconv.Itoa(info.UserID)))
+			}
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestTraceRequest(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	id, err := app.snippets.Insert(context.Background(), "An old silent pond", "An old silent pond...", 7, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// запрос продолжает трейс вызывающего
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/snippet/view/%d", ts.URL, id), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, header, _ := readResponse(t, rs)
+	assert.Equal(t, code, http.StatusOK)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	server, ok := spans["GET /snippet/view/{id}"]
+	if !ok {
+		t.Fatal("no span for the request")
+	}
+	assert.Equal(t, server.SpanContext().TraceID().String(), traceID)
+	assert.Equal(t, server.Parent().SpanID().String(), "00f067aa0ba902b7")
+
+	attrs := map[string]string{}
+	for _, kv := range server.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	assert.Equal(t, attrs["http.route"], "GET /snippet/view/{id}")
+	assert.Equal(t, attrs["http.response.status_code"], "200")
+	assert.Equal(t, attrs["request_id"], header.Get("X-Request-ID"))
+
+	render, ok := spans["render view.html"]
+	if !ok {
+		t.Fatal("no span for render")
+	}
+	assert.Equal(t, render.Parent().SpanID(), server.SpanContext().SpanID())
+}
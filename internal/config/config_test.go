@@ -0,0 +1,281 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.glebich/internal/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "snippetbox.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func env(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := writeFile(t, `
+addr: ":9000"
+page-size: 20
+db-timeout: 5s
+log-level: warn
+`)
+
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := Load("web", nil, env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var printed, want bytes.Buffer
+		cfg.Print(&printed)
+		Default().Print(&want)
+		assert.Equal(t, printed.String(), want.String())
+	})
+
+	t.Run("File", func(t *testing.T) {
+		cfg, err := Load("web", []string{"-config", file}, env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, cfg.Addr, ":9000")
+		assert.Equal(t, cfg.PageSize, 20)
+		assert.Equal(t, cfg.DBTimeout, 5*time.Second)
+		assert.Equal(t, cfg.LogLevel, "warn")
+		assert.Equal(t, cfg.ReapBatch, Default().ReapBatch)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		cfg, err := Load("web", []string{"-access-log-exclude", " /static/, ,/healthz"}, env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strings.Join(cfg.AccessLogExclude, "|"), "/static/|/healthz")
+
+		cfg, err = Load("web", nil, env(map[string]string{"ACCESS_LOG_EXCLUDE": ""}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strings.Join(cfg.AccessLogExclude, "|"), "/static/")
+	})
+
+	t.Run("Env overrides file", func(t *testing.T) {
+		cfg, err := Load("web", nil, env(map[string]string{
+			"CONFIG_FILE": file,
+			"PAGE_SIZE":   "30",
+			"DB_DSN":      "sqlite:test.db",
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, cfg.Addr, ":9000")
+		assert.Equal(t, cfg.PageSize, 30)
+		assert.Equal(t, cfg.DSN, "sqlite:test.db")
+	})
+
+	t.Run("PORT", func(t *testing.T) {
+		cfg, err := Load("web", nil, env(map[string]string{"PORT": "4000"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, cfg.Addr, ":4000")
+
+		// ADDR точнее PORT
+		cfg, err = Load("web", nil, env(map[string]string{"PORT": "4000", "ADDR": "127.0.0.1:5000"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, cfg.Addr, "127.0.0.1:5000")
+	})
+
+	t.Run("Flags override env and file", func(t *testing.T) {
+		args := []string{"-config", file, "-page-size", "40", "-addr", ":7000"}
+		cfg, err := Load("web", args, env(map[string]string{"PAGE_SIZE": "30"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, cfg.PageSize, 40)
+		assert.Equal(t, cfg.Addr, ":7000")
+		assert.Equal(t, cfg.LogLevel, "warn")
+	})
+
+	t.Run("Flag equal to default still wins", func(t *testing.T) {
+		cfg, err := Load("web", []string{"-config", file, "-page-size", "10"}, env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, cfg.PageSize, 10)
+	})
+
+	t.Run("Print config", func(t *testing.T) {
+		cfg, err := Load("web", []string{"-print-config"}, env(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, cfg.PrintConfig, true)
+	})
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		wantErr string
+	}{
+		{
+			name:    "Unknown key",
+			file:    "adress: \":9000\"\n",
+			wantErr: `unknown key "adress"`,
+		},
+		{
+			name:    "Bad file value",
+			file:    "page-size: many\n",
+			wantErr: "page-size",
+		},
+		{
+			name:    "Bad env value",
+			env:     map[string]string{"DB_TIMEOUT": "soon"},
+			wantErr: "DB_TIMEOUT",
+		},
+		{
+			name:    "Missing file",
+			args:    []string{"-config", filepath.Join(os.TempDir(), "no-such-snippetbox.yaml")},
+			wantErr: "no-such-snippetbox.yaml",
+		},
+		{
+			name:    "Invalid log level",
+			env:     map[string]string{"LOG_LEVEL": "verbose"},
+			wantErr: "log-level",
+		},
+		{
+			name:    "Invalid DSN",
+			args:    []string{"-dsn", "mysql://localhost/snippetbox"},
+			wantErr: "dsn must start with",
+		},
+		{
+			name:    "Invalid access log sample",
+			args:    []string{"-access-log-sample", "1.5"},
+			wantErr: "access-log-sample",
+		},
+		{
+			name:    "Several errors",
+			args:    []string{"-page-size", "0", "-session-days", "0"},
+			wantErr: "page-size must be positive\nconfig: session-days must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeFile(t, tt.file))
+			}
+			_, err := Load("web", args, env(tt.env))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got: %q; want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{
+			name: "Userinfo",
+			dsn:  "postgres://web:s3cret@db:5432/snippetbox?sslmode=disable",
+			want: "postgres://web:xxxxx@db:5432/snippetbox?sslmode=disable",
+		},
+		{
+			name: "Password parameter",
+			dsn:  "postgres://db/snippetbox?user=web&password=s3cret",
+			want: "postgres://db/snippetbox?password=xxxxx&user=web",
+		},
+		{
+			name: "SSL key password",
+			dsn:  "postgres://web:s3cret@db/snippetbox?sslkey=/etc/web.key&sslpassword=s3cret",
+			want: "postgres://web:xxxxx@db/snippetbox?sslkey=%2Fetc%2Fweb.key&sslpassword=xxxxx",
+		},
+		{
+			name: "No password",
+			dsn:  "postgres://web@db/snippetbox?sslmode=disable",
+			want: "postgres://web@db/snippetbox?sslmode=disable",
+		},
+		{
+			name: "SQLite",
+			dsn:  "sqlite:/var/lib/snippetbox/snippetbox.db",
+			want: "sqlite:/var/lib/snippetbox/snippetbox.db",
+		},
+		{
+			name: "Unescaped percent",
+			dsn:  "postgres://web:50%off@db/snippetbox",
+			want: "xxxxx",
+		},
+		{
+			name: "Malformed query",
+			dsn:  "postgres://db/snippetbox?password=50%off",
+			want: "xxxxx",
+		},
+		{
+			name: "Key value",
+			dsn:  "host=db user=web password=s3cret",
+			want: "xxxxx",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, redact(tt.dsn), tt.want)
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := Default()
+	cfg.DSN = "postgres://web:s3cret@db:5432/snippetbox?sslmode=disable"
+	cfg.DBTimeout = 7 * time.Second
+	cfg.IntrospectSecret = "hunter2"
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	assert.Equal(t, strings.Contains(out, "s3cret"), false)
+	assert.Equal(t, strings.Contains(out, "hunter2"), false)
+	assert.Equal(t, strings.Contains(out, "introspect-secret: xxxxx\n"), true)
+	assert.Equal(t, strings.Contains(out, "dsn: postgres://web:xxxxx@db:5432/snippetbox?sslmode=disable\n"), true)
+	assert.Equal(t, strings.Contains(out, "db-timeout: 7s\n"), true)
+	assert.Equal(t, strings.Contains(out, "addr: :8000\n"), true)
+
+	// вывод Print читается обратно как файл -config
+	withoutDSN := strings.Replace(out, "dsn: postgres://web:xxxxx@db:5432/snippetbox?sslmode=disable\n", "", 1)
+	loaded, err := Load("web", []string{"-config", writeFile(t, withoutDSN)}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, loaded.DBTimeout, 7*time.Second)
+	assert.Equal(t, loaded.Addr, cfg.Addr)
+}
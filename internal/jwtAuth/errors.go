@@ -8,4 +8,6 @@ var (
 	ErrUpdateJWTCookie     = errors.New("jwtAuth: need to update access token")
 	ErrInvalidRefreshToken = errors.New("jwtAuth: invalid refresh token")
 	ErrServerError         = errors.New("jwtAuth: server error")
+	ErrStaleToken          = errors.New("jwtAuth: token issued before password change")
+	ErrRevokedToken        = errors.New("jwtAuth: token revoked")
 )
@@ -0,0 +1,88 @@
+package jwtAuth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"slices"
+	"strings"
+)
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWKSet - содержимое /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи набора, отсортированные по kid. Ключи HS256
+// не публикуются: секрет нельзя раскрывать, такие токены проверяются
+// только самим snippetbox или через Introspect
+func (kr *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range kr.keys {
+		enc := base64.RawURLEncoding.EncodeToString
+		switch pub := k.Public().(type) {
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{Kty: "OKP", Crv: "Ed25519", X: enc(pub), Kid: k.ID, Alg: k.Method.Alg(), Use: "sig"})
+		case *ecdsa.PublicKey:
+			// координаты P-256 всегда дополняются до 32 байт
+			x, y := make([]byte, 32), make([]byte, 32)
+			pub.X.FillBytes(x)
+			pub.Y.FillBytes(y)
+			set.Keys = append(set.Keys, JWK{Kty: "EC", Crv: "P-256", X: enc(x), Y: enc(y), Kid: k.ID, Alg: k.Method.Alg(), Use: "sig"})
+		}
+	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return set
+}
+
+// Introspection - ответ на запрос интроспекции (RFC 7662).
+// Для недействительного токена заполнено только Active
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Sub       string   `json:"sub,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+}
+
+// Introspection описывает действующий токен. Проверить его - ParseClaims
+// и версию пользователя - должен вызывающий
+func (c *Claims) Introspection() Introspection {
+	info := Introspection{
+		Active:    true,
+		Sub:       c.Subject,
+		Username:  c.Name,
+		Email:     c.Email,
+		Roles:     c.Roles,
+		TokenType: "access_token",
+		Iss:       c.Issuer,
+		Aud:       c.Audience,
+		Jti:       c.ID,
+	}
+	if c.ExpiresAt != nil {
+		info.Exp = c.ExpiresAt.Unix()
+	}
+	if c.IssuedAt != nil {
+		info.Iat = c.IssuedAt.Unix()
+	}
+	return info
+}
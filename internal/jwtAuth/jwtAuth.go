@@ -1,65 +1,108 @@
 package jwtAuth
 
 import (
+	"crypto/rand"
 	"fmt"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var secretKey = []byte("KJsPBp58VA3u9ZpQo8nfoAVin7E3c/fV9sm4ygwaJUI=")
+// AccessTokenTTL - время жизни access токена по умолчанию, дальше браузер обменивает refresh токен
+const AccessTokenTTL = 15 * time.Minute
 
+// Sub - пользователь, которому выдан токен
 type Sub struct {
 	ID    int
 	Name  string
 	Email string
+	Roles []string
+	// TokenVersion увеличивается при смене пароля, токены со старой версией не принимаются
+	TokenVersion int
 }
 
-func CreateJWTToken(name, email string, id int) (string, error) {
-	user := Sub{
-		ID:    id,
-		Name:  name,
-		Email: email,
+// HasRole сообщает, есть ли у пользователя роль role
+func (s *Sub) HasRole(role string) bool {
+	return slices.Contains(s.Roles, role)
+}
+
+// Claims - содержимое access токена. sub - id пользователя строкой, jti -
+// уникальный идентификатор токена
+type Claims struct {
+	jwt.RegisteredClaims
+	Name         string   `json:"name"`
+	Email        string   `json:"email"`
+	Roles        []string `json:"roles,omitempty"`
+	TokenVersion int      `json:"token_version"`
+}
+
+// User возвращает пользователя, которому выдан токен
+func (c *Claims) User() (*Sub, error) {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil || id < 1 {
+		return nil, fmt.Errorf("jwtAuth: invalid sub %q", c.Subject)
 	}
-	payload := jwt.MapClaims{
-		"sub": user,
-		"exp": time.Now().Add(15 * time.Minute).Unix(),
+	return &Sub{
+		ID:           id,
+		Name:         c.Name,
+		Email:        c.Email,
+		Roles:        c.Roles,
+		TokenVersion: c.TokenVersion,
+	}, nil
+}
+
+// CreateJWTToken выдаёт access токен пользователю user. Claims нужны,
+// чтобы знать jti и срок действия выданного токена
+func (kr *Keyring) CreateJWTToken(user *Sub) (string, *Claims, error) {
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    kr.Issuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{kr.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(kr.TTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        rand.Text(),
+		},
+		Name:         user.Name,
+		Email:        user.Email,
+		Roles:        user.Roles,
+		TokenVersion: user.TokenVersion,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	tokenString, err := token.SignedString(secretKey)
+	token := jwt.NewWithClaims(kr.signing.Method, &claims)
+	token.Header["kid"] = kr.signing.ID
+	tokenString, err := token.SignedString(kr.signing.sign)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return tokenString, nil
+	return tokenString, &claims, nil
 }
 
-func VerifyJWTToken(tokenString string) (*Sub, error) {
-	keyFunc := func(token *jwt.Token) (any, error) {
-		return secretKey, nil
-	}
-	token, err := jwt.Parse(tokenString, keyFunc)
+// ParseClaims проверяет подпись, срок действия, издателя и получателя токена.
+// Версию токена проверить здесь нельзя - текущая версия пользователя хранится в БД
+func (kr *Keyring) ParseClaims(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, kr.keyFunc,
+		jwt.WithIssuer(kr.Issuer),
+		jwt.WithAudience(kr.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 	if err != nil {
 		return nil, err
 	}
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid claims type")
-	}
-
-	subMap, ok := claims["sub"].(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("invalid claims")
+	if claims.ID == "" {
+		return nil, fmt.Errorf("jwtAuth: token without jti")
 	}
+	return claims, nil
+}
 
-	user := &Sub{
-		ID:    int(subMap["ID"].(float64)),
-		Name:  subMap["Name"].(string),
-		Email: subMap["Email"].(string),
+func (kr *Keyring) VerifyJWTToken(tokenString string) (*Sub, error) {
+	claims, err := kr.ParseClaims(tokenString)
+	if err != nil {
+		return nil, err
 	}
-
-	return user, nil
+	return claims.User()
 }
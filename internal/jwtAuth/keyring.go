@@ -0,0 +1,263 @@
+package jwtAuth
+
+import (
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// минимальная длина секрета HS256 - не короче самого хеша
+const minHMACSecret = 32
+
+// значения iss и aud по умолчанию
+const (
+	DefaultIssuer   = "snippetbox"
+	DefaultAudience = "snippetbox"
+)
+
+// Key - ключ, которым подписываются или проверяются токены.
+// ID попадает в заголовок kid, по нему при проверке находится нужный ключ
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   any // nil - ключ только для проверки
+	verify any
+}
+
+// CanSign сообщает, есть ли у ключа приватная часть (или секрет для HS256)
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// Public возвращает открытый ключ (ed25519.PublicKey или *ecdsa.PublicKey).
+// Для HS256 открытого ключа нет - nil
+func (k *Key) Public() any {
+	if k.Method == jwt.SigningMethodHS256 {
+		return nil
+	}
+	return k.verify
+}
+
+// NewHMACKey создаёт ключ HS256 из общего секрета
+func NewHMACKey(kid string, secret []byte) (*Key, error) {
+	if len(secret) < minHMACSecret {
+		return nil, fmt.Errorf("jwtAuth: key %q: HS256 secret must be at least %d bytes", kid, minHMACSecret)
+	}
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+}
+
+// ParsePEMKey разбирает ключ EdDSA или ES256 в PEM. Из приватного ключа
+// получается ключ для подписи, из открытого - только для проверки
+func ParsePEMKey(kid, alg string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwtAuth: key %q: no PEM data", kid)
+	}
+	private := block.Type != "PUBLIC KEY"
+
+	switch alg {
+	case "EdDSA":
+		if !private {
+			pub, err := jwt.ParseEdPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("jwtAuth: key %q: %w", kid, err)
+			}
+			return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, verify: pub}, nil
+		}
+		priv, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("jwtAuth: key %q: %w", kid, err)
+		}
+		edPriv := priv.(ed25519.PrivateKey)
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, sign: edPriv, verify: edPriv.Public()}, nil
+	case "ES256":
+		if !private {
+			pub, err := jwt.ParseECPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("jwtAuth: key %q: %w", kid, err)
+			}
+			if pub.Curve != elliptic.P256() {
+				return nil, fmt.Errorf("jwtAuth: key %q: ES256 requires a P-256 key", kid)
+			}
+			return &Key{ID: kid, Method: jwt.SigningMethodES256, verify: pub}, nil
+		}
+		priv, err := jwt.ParseECPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("jwtAuth: key %q: %w", kid, err)
+		}
+		if priv.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("jwtAuth: key %q: ES256 requires a P-256 key", kid)
+		}
+		return &Key{ID: kid, Method: jwt.SigningMethodES256, sign: priv, verify: &priv.PublicKey}, nil
+	default:
+		return nil, fmt.Errorf("jwtAuth: key %q: unsupported algorithm %q", kid, alg)
+	}
+}
+
+// Keyring - набор ключей: одним подписываются новые токены, все остальные
+// принимаются при проверке. Во время ротации новый ключ добавляется в набор
+// заранее, затем становится ключом подписи, а старый удаляется, когда
+// выданные им токены истекли
+type Keyring struct {
+	// Issuer и Audience записываются в новые токены и обязательны при проверке
+	Issuer   string
+	Audience string
+	// TTL - время жизни новых токенов
+	TTL time.Duration
+
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeyring собирает набор из keys, подписывать будет ключ signingKID
+func NewKeyring(signingKID string, keys ...*Key) (*Keyring, error) {
+	kr := &Keyring{
+		Issuer:   DefaultIssuer,
+		Audience: DefaultAudience,
+		TTL:      AccessTokenTTL,
+		keys:     make(map[string]*Key, len(keys)),
+	}
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, fmt.Errorf("jwtAuth: key without kid")
+		}
+		if _, ok := kr.keys[k.ID]; ok {
+			return nil, fmt.Errorf("jwtAuth: duplicate kid %q", k.ID)
+		}
+		kr.keys[k.ID] = k
+	}
+
+	signing, ok := kr.keys[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("jwtAuth: signing key %q not found", signingKID)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("jwtAuth: signing key %q has no private part", signingKID)
+	}
+	kr.signing = signing
+	return kr, nil
+}
+
+// EphemeralSecret возвращает случайный секрет для EphemeralKeyring
+func EphemeralSecret() ([]byte, error) {
+	secret := make([]byte, minHMACSecret)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EphemeralKeyring создаёт ключ HS256 из secret, который нигде не хранится
+// и живёт до перезапуска. Подходит для разработки: после перезапуска JWT
+// перестают приниматься, и браузеры получают новые по refresh токену
+func EphemeralKeyring(secret []byte) (*Keyring, error) {
+	key, err := NewHMACKey("ephemeral", secret)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(key.ID, key)
+}
+
+// keyringFile - формат файла с ключами:
+//
+//	{
+//	  "signing": "2025-06",
+//	  "keys": [
+//	    {"kid": "2025-06", "alg": "EdDSA", "file": "jwt-2025-06.pem"},
+//	    {"kid": "2025-01", "alg": "HS256", "secret": "base64..."}
+//	  ]
+//	}
+//
+// Пути в file считаются от каталога, где лежит сам файл
+type keyringFile struct {
+	Signing string `json:"signing"`
+	Keys    []struct {
+		KID    string `json:"kid"`
+		Alg    string `json:"alg"`
+		File   string `json:"file"`
+		Secret string `json:"secret"`
+	} `json:"keys"`
+}
+
+// LoadKeyring читает набор ключей из JSON файла path
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f keyringFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("jwtAuth: %s: %w", path, err)
+	}
+
+	keys := make([]*Key, 0, len(f.Keys))
+	for _, k := range f.Keys {
+		var key *Key
+		switch k.Alg {
+		case "HS256":
+			secret, err := base64.StdEncoding.DecodeString(k.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("jwtAuth: key %q: secret must be base64: %w", k.KID, err)
+			}
+			key, err = NewHMACKey(k.KID, secret)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			file := k.File
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(path), file)
+			}
+			pemData, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("jwtAuth: key %q: %w", k.KID, err)
+			}
+			key, err = ParsePEMKey(k.KID, k.Alg, pemData)
+			if err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+	}
+	return NewKeyring(f.Signing, keys...)
+}
+
+// SigningKey возвращает ключ, которым подписываются новые токены
+func (kr *Keyring) SigningKey() *Key {
+	return kr.signing
+}
+
+// Keys возвращает все ключи набора, включая ключ подписи
+func (kr *Keyring) Keys() []*Key {
+	keys := make([]*Key, 0, len(kr.keys))
+	for _, k := range kr.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// keyFunc находит ключ проверки по kid и не даёт подменить алгоритм:
+// токен должен быть подписан тем алгоритмом, для которого заведён ключ
+func (kr *Keyring) keyFunc(token *jwt.Token) (any, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("jwtAuth: token without kid")
+	}
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("jwtAuth: unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("jwtAuth: kid %q expects %s, got %s", kid, key.Method.Alg(), token.Method.Alg())
+	}
+	return key.verify, nil
+}
@@ -0,0 +1,336 @@
+package jwtAuth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"snippetbox.glebich/internal/assert"
+)
+
+func pemEncode(t *testing.T, typ string, der []byte, err error) []byte {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+func newEdDSAKey(t *testing.T, kid string) (*Key, []byte) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	privPEM := pemEncode(t, "PRIVATE KEY", der, err)
+	der, err = x509.MarshalPKIXPublicKey(priv.Public())
+	pubPEM := pemEncode(t, "PUBLIC KEY", der, err)
+
+	key, err := ParsePEMKey(kid, "EdDSA", privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pubPEM
+}
+
+func newES256Key(t *testing.T, kid string) (*Key, []byte) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(priv)
+	privPEM := pemEncode(t, "EC PRIVATE KEY", der, err)
+	der, err = x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	pubPEM := pemEncode(t, "PUBLIC KEY", der, err)
+
+	key, err := ParsePEMKey(kid, "ES256", privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pubPEM
+}
+
+var alice = &Sub{ID: 7, Name: "alice", Email: "alice@example.com", Roles: []string{"admin"}, TokenVersion: 2}
+
+// validClaims - содержимое токена, которое Keyring с настройками по умолчанию принимает
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			Subject:   "7",
+			Audience:  jwt.ClaimStrings{DefaultAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "jti",
+		},
+	}
+}
+
+func TestKeyringAlgorithms(t *testing.T) {
+	hmacKey, err := NewHMACKey("hs", []byte(strings.Repeat("s", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, edPub := newEdDSAKey(t, "ed")
+	esKey, esPub := newES256Key(t, "es")
+
+	tests := []struct {
+		name   string
+		key    *Key
+		public []byte
+	}{
+		{name: "HS256", key: hmacKey},
+		{name: "EdDSA", key: edKey, public: edPub},
+		{name: "ES256", key: esKey, public: esPub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := NewKeyring(tt.key.ID, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokenString, _, err := kr.CreateJWTToken(alice)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, token.Header["kid"], any(tt.key.ID))
+			assert.Equal(t, token.Method.Alg(), tt.name)
+
+			user, err := kr.VerifyJWTToken(tokenString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, user.ID, alice.ID)
+			assert.Equal(t, user.Email, alice.Email)
+			assert.Equal(t, user.HasRole("admin"), true)
+			assert.Equal(t, user.TokenVersion, alice.TokenVersion)
+
+			if tt.public == nil {
+				return
+			}
+			// другому сервису для проверки достаточно открытого ключа
+			pub, err := ParsePEMKey(tt.key.ID, tt.name, tt.public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, pub.CanSign(), false)
+			verifier := &Keyring{keys: map[string]*Key{pub.ID: pub}}
+			_, err = verifier.VerifyJWTToken(tokenString)
+			assert.Equal(t, err, nil)
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey, err := NewHMACKey("old", []byte(strings.Repeat("o", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, _ := newEdDSAKey(t, "new")
+
+	before, err := NewKeyring("old", oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _, err := before.CreateJWTToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// новый ключ подписывает, старый ещё принимается
+	during, err := NewKeyring("new", newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = during.VerifyJWTToken(oldToken)
+	assert.Equal(t, err, nil)
+	newToken, _, err := during.CreateJWTToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// старый ключ удалён - его токены больше не принимаются
+	after, err := NewKeyring("new", newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = after.VerifyJWTToken(newToken)
+	assert.Equal(t, err, nil)
+	_, err = after.VerifyJWTToken(oldToken)
+	assert.Equal(t, err != nil, true)
+}
+
+func TestKeyringRejects(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	hmacKey, err := NewHMACKey("hs", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr, err := NewKeyring("hs", hmacKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, header map[string]any, key any, change func(c *Claims)) string {
+		claims := validClaims()
+		if change != nil {
+			change(claims)
+		}
+		token := jwt.NewWithClaims(method, claims)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	kid := map[string]any{"kid": "hs"}
+	unknown := map[string]any{"kid": "other"}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "No kid", token: sign(jwt.SigningMethodHS256, nil, secret, nil)},
+		{name: "Unknown kid", token: sign(jwt.SigningMethodHS256, unknown, secret, nil)},
+		{name: "Wrong algorithm", token: sign(jwt.SigningMethodHS512, kid, secret, nil)},
+		{name: "Wrong secret", token: sign(jwt.SigningMethodHS256, kid, []byte(strings.Repeat("x", 32)), nil)},
+		{name: "Wrong issuer", token: sign(jwt.SigningMethodHS256, kid, secret, func(c *Claims) { c.Issuer = "other" })},
+		{name: "Wrong audience", token: sign(jwt.SigningMethodHS256, kid, secret, func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} })},
+		{name: "Expired", token: sign(jwt.SigningMethodHS256, kid, secret, func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) })},
+		{name: "No expiration", token: sign(jwt.SigningMethodHS256, kid, secret, func(c *Claims) { c.ExpiresAt = nil })},
+		{name: "No jti", token: sign(jwt.SigningMethodHS256, kid, secret, func(c *Claims) { c.ID = "" })},
+		{name: "Malformed sub", token: sign(jwt.SigningMethodHS256, kid, secret, func(c *Claims) { c.Subject = "alice" })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kr.VerifyJWTToken(tt.token)
+			assert.Equal(t, err != nil, true)
+		})
+	}
+
+	t.Run("Short secret", func(t *testing.T) {
+		_, err := NewHMACKey("short", []byte("secret"))
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Public signing key", func(t *testing.T) {
+		_, pubPEM := newEdDSAKey(t, "ed")
+		pub, err := ParsePEMKey("ed", "EdDSA", pubPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewKeyring("ed", pub)
+		assert.Equal(t, err != nil, true)
+	})
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	edKey, _ := newEdDSAKey(t, "2025-06")
+	der, err := x509.MarshalPKCS8PrivateKey(edKey.sign)
+	if err := os.WriteFile(filepath.Join(dir, "jwt.pem"), pemEncode(t, "PRIVATE KEY", der, err), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := `{
+		"signing": "2025-06",
+		"keys": [
+			{"kid": "2025-06", "alg": "EdDSA", "file": "jwt.pem"},
+			{"kid": "2025-01", "alg": "HS256", "secret": "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA=="}
+		]
+	}`
+	path := filepath.Join(dir, "keyring.json")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, kr.SigningKey().ID, "2025-06")
+	assert.Equal(t, kr.SigningKey().Method.Alg(), "EdDSA")
+	assert.Equal(t, len(kr.Keys()), 2)
+}
+
+func TestJWKS(t *testing.T) {
+	hmacKey, err := NewHMACKey("hs", []byte(strings.Repeat("s", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _ := newEdDSAKey(t, "ed")
+	esKey, _ := newES256Key(t, "es")
+	kr, err := NewKeyring("hs", hmacKey, edKey, esKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// секрет HS256 не публикуется
+	set := kr.JWKS()
+	assert.Equal(t, len(set.Keys), 2)
+
+	ed := set.Keys[0]
+	assert.Equal(t, ed.Kid, "ed")
+	assert.Equal(t, ed.Kty, "OKP")
+	assert.Equal(t, ed.Alg, "EdDSA")
+	x, err := base64.RawURLEncoding.DecodeString(ed.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, edKey.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)), true)
+
+	es := set.Keys[1]
+	assert.Equal(t, es.Kid, "es")
+	assert.Equal(t, es.Kty, "EC")
+	assert.Equal(t, es.Crv, "P-256")
+	assert.Equal(t, len(es.X), 43)
+	assert.Equal(t, len(es.Y), 43)
+}
+
+func TestIntrospection(t *testing.T) {
+	edKey, _ := newEdDSAKey(t, "ed")
+	kr, err := NewKeyring("ed", edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenString, _, err := kr.CreateJWTToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := kr.ParseClaims(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := claims.Introspection()
+	assert.Equal(t, info.Active, true)
+	assert.Equal(t, info.Sub, "7")
+	assert.Equal(t, info.Email, "alice@example.com")
+	assert.Equal(t, info.Iss, DefaultIssuer)
+	assert.Equal(t, info.Jti != "", true)
+	assert.Equal(t, len(info.Roles), 1)
+}
@@ -0,0 +1,319 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// имя файла миграции: 0001_create_users.up.sql / 0001_create_users.down.sql
+var regexpFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrNoMigrations = errors.New("migrate: no migrations to roll back")
+
+// lockKey - ключ advisory lock в Postgres, под которым применяются миграции,
+// чтобы два процесса, запущенные с -migrate, не применяли их одновременно
+const lockKey = 0x6d696772 // "migr"
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - миграция и момент её применения (нулевой, если ещё не применена)
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+// Migrator применяет миграции к DB. Dialect ("postgres" или "sqlite")
+// определяет, как Up и Down не дают другим процессам применять миграции
+// одновременно с ними
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    string
+	Migrations []Migration
+}
+
+// conn - общее у *sql.DB и *sql.Conn, на котором Up и Down держат блокировку
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// New читает миграции из fsys (обычно migrations.FS(dialect)) и возвращает Migrator
+func New(db *sql.DB, dialect string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Dialect: dialect, Migrations: migrations}, nil
+}
+
+// Load собирает пары up/down файлов из корня fsys и сортирует их по версии
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := regexpFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d used by %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrate: migration %04d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (m *Migrator) init(db conn) error {
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied TIMESTAMP NOT NULL)`
+	_, err := db.ExecContext(context.Background(), stmt)
+	return err
+}
+
+func (m *Migrator) applied(db conn) (map[int]time.Time, error) {
+	if err := m.init(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(context.Background(), `SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Status возвращает все известные миграции с отметкой, применены ли они
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		statuses = append(statuses, Status{Migration: migration, Applied: applied[migration.Version]})
+	}
+	return statuses, nil
+}
+
+// Up применяет все ещё не применённые миграции по порядку.
+// Каждая миграция выполняется в своей транзакции. Миграции, которые
+// тем временем применил другой процесс, пропускаются
+func (m *Migrator) Up() ([]Migration, error) {
+	db, unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		ran, err := m.run(db, migration.Version, false, migration.Up, `INSERT INTO schema_migrations (version, name, applied)
+		VALUES ($1, $2, $3)`, migration.Version, migration.Name, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migrate: %04d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down откатывает steps последних применённых миграций
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	db, unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		ran, err := m.run(db, migration.Version, true, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		if err != nil {
+			return done, fmt.Errorf("migrate: %04d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+	if len(done) == 0 {
+		return nil, ErrNoMigrations
+	}
+	return done, nil
+}
+
+// Pending возвращает миграции, которые ещё не применены
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return nil, err
+	}
+	pending := []Migration{}
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// UpToDate сообщает, применены ли все миграции. В отличие от Pending
+// не создаёт schema_migrations и ограничена ctx - годится для проверки
+// готовности, которую вызывают часто
+func (m *Migrator) UpToDate(ctx context.Context) (bool, error) {
+	rows, err := m.DB.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return false, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	for _, migration := range m.Migrations {
+		if !applied[migration.Version] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lock берёт advisory lock на отдельном соединении и возвращает его: Up
+// и Down выполняются на нём же, блокировка сессионная. Если миграции
+// применяет другой процесс, lock ждёт, пока он закончит. В SQLite
+// блокировки нет: run проверяет версию в immediate-транзакции, которая
+// сразу захватывает файл на запись
+func (m *Migrator) lock() (_ conn, unlock func(), err error) {
+	if m.Dialect != "postgres" {
+		return m.DB, func() {}, nil
+	}
+
+	ctx := context.Background()
+	c, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = c.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+
+	return c, func() {
+		_, err := c.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey)
+		if err != nil {
+			// соединение с неснятой блокировкой нельзя возвращать в пул
+			c.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		c.Close()
+	}, nil
+}
+
+// run выполняет тело миграции и запись в schema_migrations в одной транзакции,
+// если версия ещё в состоянии applied: другой процесс мог применить или
+// откатить её после того, как Up или Down прочитали schema_migrations.
+// ran сообщает, была ли миграция выполнена
+func (m *Migrator) run(db conn, version int, applied bool, body string, record string, args ...any) (ran bool, err error) {
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&exists)
+	if err != nil || exists != applied {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, body); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,169 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+	"snippetbox.glebich/internal/assert"
+	"snippetbox.glebich/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"efs.go":               {Data: []byte("package migrations")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(migrations), 2)
+	assert.Equal(t, migrations[0].Version, 1)
+	assert.Equal(t, migrations[0].Name, "first")
+	assert.Equal(t, migrations[0].Down, "DROP TABLE a;")
+	assert.Equal(t, migrations[1].Version, 2)
+	assert.Equal(t, migrations[1].Up, "CREATE TABLE b (id INTEGER);")
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "Missing down",
+			fsys: fstest.MapFS{
+				"0001_first.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+			},
+		},
+		{
+			name: "Duplicate version",
+			fsys: fstest.MapFS{
+				"0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+				"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+				"0001_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+				"0001_second.down.sql": {Data: []byte("DROP TABLE b;")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys)
+			assert.Equal(t, err != nil, true)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		t.Run(dialect, func(t *testing.T) {
+			fsys, err := migrations.FS(dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := Load(fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, len(loaded) > 0, true)
+			for i, m := range loaded {
+				assert.Equal(t, m.Version, i+1)
+			}
+		})
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	fsys := fstest.MapFS{
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	m, err := New(db, "sqlite", fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// таблицы schema_migrations ещё нет - это ошибка, а не "всё применено"
+	_, err = m.UpToDate(ctx)
+	assert.Equal(t, err != nil, true)
+
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := m.UpToDate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ok, true)
+
+	if _, err := m.Down(1); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = m.UpToDate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ok, false)
+}
+
+func TestUpConcurrent(t *testing.T) {
+	// как models.OpenDB: транзакции immediate и ожидание чужой блокировки
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_txlock=immediate"
+	fsys := fstest.MapFS{
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+
+	// каждый Migrator со своим пулом, как два процесса, запущенных с -migrate
+	const processes = 4
+	applied := make([][]Migration, processes)
+	errs := make([]error, processes)
+	var wg sync.WaitGroup
+	for i := range processes {
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		m, err := New(db, "sqlite", fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = m.Up()
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range processes {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		total += len(applied[i])
+	}
+	// каждая миграция применена ровно один раз
+	assert.Equal(t, total, 2)
+}
@@ -6,4 +6,6 @@ var (
 	ErrNoRecord         = errors.New("models: no matching record found")
 	ErrWrongCredentials = errors.New("models: wrong credentials")
 	ErrDuplicateEntry   = errors.New("models: email already registered")
+	ErrLocked           = errors.New("models: lock is held by another instance")
+	ErrTokenReused      = errors.New("models: rotated refresh token reused")
 )
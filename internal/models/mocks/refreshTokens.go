@@ -0,0 +1,216 @@
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"snippetbox.glebich/internal/jwtAuth"
+	"snippetbox.glebich/internal/models"
+)
+
+var _ models.RefreshTokenModelInterface = (*RefreshTokenModel)(nil)
+
+// accessToken - access токен, выданный сессии familyID
+type accessToken struct {
+	familyID int
+	userID   int
+	expires  time.Time
+}
+
+type RefreshTokenModel struct {
+	mu      sync.Mutex
+	users   *UserModel
+	revoked *RevokedTokenModel
+	nextID  int
+	tokens  map[int]*models.RefreshToken // по id токена
+	rotated map[int]time.Time            // когда токен заменили новым
+	access  map[string]accessToken       // по jti
+}
+
+func NewRefreshTokenModel(users *UserModel, revoked *RevokedTokenModel) *RefreshTokenModel {
+	return &RefreshTokenModel{
+		users:   users,
+		revoked: revoked,
+		nextID:  1,
+		tokens:  map[int]*models.RefreshToken{},
+		rotated: map[int]time.Time{},
+		access:  map[string]accessToken{},
+	}
+}
+
+func (m *RefreshTokenModel) Insert(ctx context.Context, value string, expires int, userId int, userAgent, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.tokens[m.nextID] = &models.RefreshToken{
+		ID:        m.nextID,
+		FamilyID:  m.nextID,
+		Hash:      models.HashToken(value),
+		UserId:    userId,
+		Expires:   now.AddDate(0, 0, expires),
+		UserAgent: userAgent,
+		IP:        ip,
+		Created:   now,
+		LastUsed:  now,
+	}
+	m.nextID++
+	return nil
+}
+
+func (m *RefreshTokenModel) Rotate(ctx context.Context, value, newValue string, expires int, ip string) (*jwtAuth.Sub, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.byValue(value)
+	if !ok {
+		return nil, false, models.ErrNoRecord
+	}
+	now := time.Now().UTC()
+	if t.Expires.Before(now) {
+		return nil, false, fmt.Errorf("expired token")
+	}
+	u, ok := m.users.byID(t.UserId)
+	if !ok {
+		return nil, false, models.ErrNoRecord
+	}
+	user := &jwtAuth.Sub{ID: u.ID, Name: u.Name, Email: u.Email, Roles: u.Roles, TokenVersion: u.TokenVersion}
+
+	if rotated, ok := m.rotated[t.ID]; ok {
+		if now.Sub(rotated) <= models.RotationGrace {
+			return user, false, nil
+		}
+		m.deleteFamily(t.FamilyID)
+		return nil, false, fmt.Errorf("%w: user %d, session %d", models.ErrTokenReused, u.ID, t.FamilyID)
+	}
+
+	m.rotated[t.ID] = now
+	m.tokens[m.nextID] = &models.RefreshToken{
+		ID:        m.nextID,
+		FamilyID:  t.FamilyID,
+		Hash:      models.HashToken(newValue),
+		UserId:    t.UserId,
+		Expires:   now.AddDate(0, 0, expires),
+		UserAgent: t.UserAgent,
+		IP:        ip,
+		Created:   t.Created,
+		LastUsed:  now,
+	}
+	m.nextID++
+	return user, true, nil
+}
+
+func (m *RefreshTokenModel) Get(ctx context.Context, value string) (*models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.byValue(value)
+	if !ok || t.Expires.Before(time.Now()) {
+		return nil, models.ErrNoRecord
+	}
+	c := *t
+	return &c, nil
+}
+
+func (m *RefreshTokenModel) SetAccessToken(ctx context.Context, value, jti string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.byValue(value); ok {
+		m.access[jti] = accessToken{familyID: t.FamilyID, userID: t.UserId, expires: expires}
+	}
+	return nil
+}
+
+func (m *RefreshTokenModel) Sessions(ctx context.Context, userId int) ([]*models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []*models.RefreshToken{}
+	for _, t := range m.tokens {
+		if _, rotated := m.rotated[t.ID]; rotated {
+			continue
+		}
+		if t.UserId == userId && t.Expires.After(time.Now()) {
+			c := *t
+			c.Hash = ""
+			sessions = append(sessions, &c)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsed.Equal(sessions[j].LastUsed) {
+			return sessions[i].LastUsed.After(sessions[j].LastUsed)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (m *RefreshTokenModel) Revoke(ctx context.Context, familyID int, userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID && t.UserId == userId {
+			m.deleteFamily(familyID)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *RefreshTokenModel) RevokeOthers(ctx context.Context, familyID int, userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.tokens {
+		if t.UserId == userId && t.FamilyID != familyID {
+			m.deleteFamily(t.FamilyID)
+		}
+	}
+	return nil
+}
+
+func (m *RefreshTokenModel) Delete(ctx context.Context, userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.tokens {
+		if t.UserId == userId {
+			m.deleteFamily(t.FamilyID)
+		}
+	}
+	return nil
+}
+
+func (m *RefreshTokenModel) byValue(value string) (*models.RefreshToken, bool) {
+	for _, t := range m.tokens {
+		if t.Hash == models.HashToken(value) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// deleteFamily удаляет токены сессии и, как RefreshTokenModel, отзывает
+// все выданные ей access токены
+func (m *RefreshTokenModel) deleteFamily(familyID int) {
+	for jti, a := range m.access {
+		if a.familyID != familyID {
+			continue
+		}
+		if a.expires.After(time.Now()) {
+			m.revoked.Revoke(context.Background(), jti, a.userID, a.expires)
+		}
+		delete(m.access, jti)
+	}
+	for id, t := range m.tokens {
+		if t.FamilyID == familyID {
+			delete(m.tokens, id)
+			delete(m.rotated, id)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"snippetbox.glebich/internal/models"
+)
+
+var _ models.RevokedTokenModelInterface = (*RevokedTokenModel)(nil)
+
+type RevokedTokenModel struct {
+	mu       sync.Mutex
+	tokens   map[string]*models.RevokedToken
+	versions map[int]int
+}
+
+func NewRevokedTokenModel() *RevokedTokenModel {
+	return &RevokedTokenModel{
+		tokens:   map[string]*models.RevokedToken{},
+		versions: map[int]int{},
+	}
+}
+
+func (m *RevokedTokenModel) Revoke(ctx context.Context, jti string, userId int, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[jti]; !ok {
+		m.tokens[jti] = &models.RevokedToken{JTI: jti, UserId: userId, Expires: expires, Revoked: time.Now().UTC()}
+	}
+	return nil
+}
+
+func (m *RevokedTokenModel) IsRevoked(jti string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tokens[jti]
+	return ok && t.Expires.After(time.Now())
+}
+
+func (m *RevokedTokenModel) RevokeVersion(ctx context.Context, userId, version int, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.versions[userId] = max(m.versions[userId], version)
+	return nil
+}
+
+func (m *RevokedTokenModel) MinVersion(userId int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.versions[userId]
+}
+
+func (m *RevokedTokenModel) Sync(ctx context.Context) error {
+	return nil
+}
+
+func (m *RevokedTokenModel) Recent(ctx context.Context, limit int) ([]*models.RevokedToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := []*models.RevokedToken{}
+	for _, t := range m.tokens {
+		if t.Expires.After(time.Now()) {
+			c := *t
+			tokens = append(tokens, &c)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].Revoked.Equal(tokens[j].Revoked) {
+			return tokens[i].Revoked.After(tokens[j].Revoked)
+		}
+		return tokens[i].JTI < tokens[j].JTI
+	})
+	if len(tokens) > limit {
+		tokens = tokens[:limit]
+	}
+	return tokens, nil
+}
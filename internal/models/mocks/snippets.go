@@ -0,0 +1,302 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.glebich/internal/models"
+)
+
+var _ models.SnippetModelInterface = (*SnippetModel)(nil)
+
+// SnippetModel - хранилище сниппетов в памяти с тем же поведением,
+// что и models.SnippetModel, для тестов обработчиков без Postgres
+type SnippetModel struct {
+	mu        sync.Mutex
+	nextID    int
+	snippets  map[int]*models.Snippet
+	revisions map[int][]*models.Revision
+}
+
+func NewSnippetModel() *SnippetModel {
+	return &SnippetModel{
+		nextID:    1,
+		snippets:  map[int]*models.Snippet{},
+		revisions: map[int][]*models.Revision{},
+	}
+}
+
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, expires int, userID int, tags []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	s := &models.Snippet{
+		ID:       m.nextID,
+		UserID:   userID,
+		Title:    title,
+		Content:  content,
+		Revision: 1,
+		Created:  now,
+		Expires:  now.AddDate(0, 0, expires),
+		Tags:     slices.Sorted(slices.Values(tags)),
+	}
+	m.nextID++
+	m.snippets[s.ID] = s
+	m.revisions[s.ID] = []*models.Revision{{SnippetID: s.ID, Number: 1, Title: title, Content: content, Created: now}}
+	return s.ID, nil
+}
+
+func (m *SnippetModel) Update(ctx context.Context, id int, userID int, title string, content string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.active(id)
+	if !ok || s.UserID != userID {
+		return 0, models.ErrNoRecord
+	}
+	s.Title, s.Content = title, content
+	s.Revision++
+	m.revisions[id] = append(m.revisions[id], &models.Revision{
+		SnippetID: id, Number: s.Revision, Title: title, Content: content, Created: time.Now().UTC(),
+	})
+	return s.Revision, nil
+}
+
+func (m *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.active(id)
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return copySnippet(s), nil
+}
+
+func (m *SnippetModel) GetRevision(ctx context.Context, id int, number int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.active(id)
+	if !ok || number < 1 || number > len(m.revisions[id]) {
+		return nil, models.ErrNoRecord
+	}
+	r := m.revisions[id][number-1]
+	c := copySnippet(s)
+	c.Title, c.Content, c.Revision = r.Title, r.Content, r.Number
+	return c, nil
+}
+
+func (m *SnippetModel) Revisions(ctx context.Context, id int) ([]*models.Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revisions := slices.Clone(m.revisions[id])
+	slices.Reverse(revisions)
+	return revisions, nil
+}
+
+func (m *SnippetModel) List(ctx context.Context, cursor models.Cursor, limit int) (*models.SnippetPage, error) {
+	return m.page(func(*models.Snippet) bool { return true }, cursor, limit), nil
+}
+
+func (m *SnippetModel) ByUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippets := []*models.Snippet{}
+	for _, s := range m.sorted() {
+		if s.UserID == userID && s.Deleted.IsZero() {
+			snippets = append(snippets, copySnippet(s))
+		}
+	}
+	return snippets, nil
+}
+
+func (m *SnippetModel) ByTag(ctx context.Context, tag string, cursor models.Cursor, limit int) (*models.SnippetPage, error) {
+	return m.page(func(s *models.Snippet) bool { return slices.Contains(s.Tags, tag) }, cursor, limit), nil
+}
+
+func (m *SnippetModel) TagCloud(ctx context.Context, limit int) ([]*models.TagCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, s := range m.snippets {
+		if _, ok := m.active(s.ID); ok {
+			for _, tag := range s.Tags {
+				counts[tag]++
+			}
+		}
+	}
+	cloud := []*models.TagCount{}
+	for name, count := range counts {
+		cloud = append(cloud, &models.TagCount{Name: name, Count: count})
+	}
+	sort.Slice(cloud, func(i, j int) bool {
+		if cloud[i].Count != cloud[j].Count {
+			return cloud[i].Count > cloud[j].Count
+		}
+		return cloud[i].Name < cloud[j].Name
+	})
+	if len(cloud) > limit {
+		cloud = cloud[:limit]
+	}
+	return cloud, nil
+}
+
+// Search вместо полнотекстового поиска ищет подстроку без учёта регистра
+func (m *SnippetModel) Search(ctx context.Context, query string, page, limit int) ([]*models.SearchResult, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	query = strings.ToLower(query)
+	results := []*models.SearchResult{}
+	for _, s := range m.sorted() {
+		if _, ok := m.active(s.ID); !ok {
+			continue
+		}
+		if strings.Contains(strings.ToLower(s.Title), query) || strings.Contains(strings.ToLower(s.Content), query) {
+			results = append(results, &models.SearchResult{Snippet: copySnippet(s), Rank: 1, Headline: s.Content})
+		}
+	}
+
+	start := min((page-1)*limit, len(results))
+	end := min(start+limit, len(results))
+	return results[start:end], end < len(results), nil
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || s.UserID != userID || !s.Deleted.IsZero() {
+		return models.ErrNoRecord
+	}
+	s.Deleted = time.Now().UTC()
+	return nil
+}
+
+func (m *SnippetModel) Restore(ctx context.Context, id int, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || s.UserID != userID || !inTrash(s) {
+		return models.ErrNoRecord
+	}
+	s.Deleted = time.Time{}
+	return nil
+}
+
+func (m *SnippetModel) Purge(ctx context.Context, id int, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || s.UserID != userID || s.Deleted.IsZero() {
+		return models.ErrNoRecord
+	}
+	delete(m.snippets, id)
+	delete(m.revisions, id)
+	return nil
+}
+
+func (m *SnippetModel) Trash(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippets := []*models.Snippet{}
+	for _, s := range m.sorted() {
+		if s.UserID == userID && inTrash(s) {
+			snippets = append(snippets, copySnippet(s))
+		}
+	}
+	sort.SliceStable(snippets, func(i, j int) bool {
+		return snippets[i].Deleted.After(snippets[j].Deleted)
+	})
+	return snippets, nil
+}
+
+// page повторяет keyset-пагинацию models.SnippetModel по активным сниппетам,
+// для которых match возвращает true
+func (m *SnippetModel) page(match func(*models.Snippet) bool, cursor models.Cursor, limit int) *models.SnippetPage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := []*models.Snippet{}
+	for _, s := range m.sorted() {
+		if _, ok := m.active(s.ID); ok && match(s) {
+			all = append(all, copySnippet(s))
+		}
+	}
+
+	p := &models.SnippetPage{}
+	switch {
+	case cursor.Before > 0:
+		end := 0
+		for end < len(all) && all[end].ID > cursor.Before {
+			end++
+		}
+		start := max(end-limit, 0)
+		p.Snippets = all[start:end]
+		if len(p.Snippets) > 0 {
+			p.Next = p.Snippets[len(p.Snippets)-1].ID
+			if start > 0 {
+				p.Prev = p.Snippets[0].ID
+			}
+		}
+	default:
+		start := 0
+		for cursor.After > 0 && start < len(all) && all[start].ID >= cursor.After {
+			start++
+		}
+		end := min(start+limit, len(all))
+		p.Snippets = all[start:end]
+		if len(p.Snippets) > 0 {
+			if end < len(all) {
+				p.Next = p.Snippets[len(p.Snippets)-1].ID
+			}
+			if cursor.After > 0 {
+				p.Prev = p.Snippets[0].ID
+			}
+		}
+	}
+	return p
+}
+
+func (m *SnippetModel) active(id int) (*models.Snippet, bool) {
+	s, ok := m.snippets[id]
+	if !ok || !s.Deleted.IsZero() || !s.Expires.After(time.Now()) {
+		return nil, false
+	}
+	return s, true
+}
+
+// sorted возвращает сниппеты от новых к старым, как ORDER BY id DESC
+func (m *SnippetModel) sorted() []*models.Snippet {
+	snippets := make([]*models.Snippet, 0, len(m.snippets))
+	for _, s := range m.snippets {
+		snippets = append(snippets, s)
+	}
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].ID > snippets[j].ID
+	})
+	return snippets
+}
+
+func inTrash(s *models.Snippet) bool {
+	return !s.Deleted.IsZero() && time.Since(s.Deleted) < models.TrashRetention*24*time.Hour
+}
+
+func copySnippet(s *models.Snippet) *models.Snippet {
+	c := *s
+	c.Tags = slices.Clone(s.Tags)
+	return &c
+}
@@ -0,0 +1,114 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"snippetbox.glebich/internal/models"
+)
+
+var _ models.UserModelInterface = (*UserModel)(nil)
+
+type UserModel struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[int]*models.User
+}
+
+func NewUserModel() *UserModel {
+	return &UserModel{
+		nextID: 1,
+		users:  map[int]*models.User{},
+	}
+}
+
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	// минимальная стоимость, чтобы тесты не тратили время на bcrypt
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return 0, models.ErrDuplicateEntry
+		}
+	}
+	u := &models.User{
+		ID:             m.nextID,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC(),
+		TokenVersion:   1,
+	}
+	m.nextID++
+	m.users[u.ID] = u
+	return u.ID, nil
+}
+
+func (m *UserModel) Get(ctx context.Context, email, password string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email != email {
+			continue
+		}
+		err := bcrypt.CompareHashAndPassword(u.HashedPassword, []byte(password))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return nil, models.ErrWrongCredentials
+			} else {
+				return nil, err
+			}
+		}
+		c := *u
+		return &c, nil
+	}
+	return nil, models.ErrWrongCredentials
+}
+
+func (m *UserModel) PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+	err := bcrypt.CompareHashAndPassword(u.HashedPassword, []byte(currentPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, models.ErrWrongCredentials
+		} else {
+			return 0, err
+		}
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+	u.HashedPassword = hashedPassword
+	u.TokenVersion++
+	return u.TokenVersion, nil
+}
+
+// byID нужен RefreshTokenModel, которому, как и в Postgres, нужны имя и почта пользователя
+func (m *UserModel) byID(id int) (*models.User, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil, false
+	}
+	c := *u
+	return &c, true
+}
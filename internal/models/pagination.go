@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Cursor указывает, относительно какого сниппета брать страницу:
+// After - более старые, чем сниппет с этим id, Before - более новые.
+// Пустой Cursor - первая страница
+type Cursor struct {
+	After  int
+	Before int
+}
+
+// SnippetPage - страница списка сниппетов. Next и Prev - курсоры для
+// соседних страниц, 0 если такой страницы нет
+type SnippetPage struct {
+	Snippets []*Snippet
+	Next     int
+	Prev     int
+}
+
+// page выбирает страницу активных сниппетов. filter - дополнительное условие
+// для WHERE, его параметры передаются в args и нумеруются с $1
+func (m *SnippetModel) page(ctx context.Context, filter string, args []any, cursor Cursor, limit int) (*SnippetPage, error) {
+	if filter != "" {
+		filter = "AND " + filter
+	}
+
+	backward := cursor.Before > 0
+	where, order := "", "DESC"
+	switch {
+	case backward:
+		args = append(args, cursor.Before)
+		where, order = fmt.Sprintf("AND id > $%d", len(args)), "ASC"
+	case cursor.After > 0:
+		args = append(args, cursor.After)
+		where = fmt.Sprintf("AND id < $%d", len(args))
+	}
+	args = append(args, time.Now().UTC())
+	now := len(args)
+	// берём на одну запись больше, чтобы понять, есть ли следующая страница
+	args = append(args, limit+1)
+
+	stmt := fmt.Sprintf(`SELECT id, COALESCE(user_id, 0), title, content, revision, created, expires FROM snippets
+	WHERE deleted IS NULL AND expires > $%d %s %s
+	ORDER BY id %s LIMIT $%d`, now, filter, where, order, len(args))
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Revision, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	more := len(snippets) > limit
+	if more {
+		snippets = snippets[:limit]
+	}
+	if backward {
+		slices.Reverse(snippets)
+	}
+
+	p := &SnippetPage{Snippets: snippets}
+	if len(snippets) == 0 {
+		return p, nil
+	}
+	// страница, с которой пришли по курсору, точно существует
+	if more || backward {
+		p.Next = snippets[len(snippets)-1].ID
+	}
+	if (more && backward) || cursor.After > 0 {
+		p.Prev = snippets[0].ID
+	}
+	return p, nil
+}
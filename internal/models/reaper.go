@@ -0,0 +1,202 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reaperLockKey - ключ advisory lock в Postgres, по которому экземпляры
+// приложения договариваются, кто из них чистит БД
+const reaperLockKey = 0x736e6970 // "snip"
+
+// Reaper окончательно удаляет то, что уже никогда не понадобится:
+// сниппеты, истекшие или лежащие в корзине дольше TrashRetention дней,
+// истекшие refresh токены, записи о выданных и отозванных access токенах,
+// которые уже истекли сами, и версии токенов, старше которых JWT уже
+// не осталось. Удаление идёт пачками по BatchSize записей, каждая пачка
+// в своей транзакции, чтобы не держать долгих блокировок
+type Reaper struct {
+	DB        *sql.DB
+	Dialect   Dialect
+	Timeout   time.Duration
+	BatchSize int
+}
+
+// ReapResult - сколько записей удалил один проход Reaper
+type ReapResult struct {
+	Snippets      int
+	RefreshTokens int
+	AccessTokens  int
+	RevokedTokens int
+	TokenVersions int
+}
+
+// Reap выполняет один проход очистки. Если её уже выполняет другой
+// экземпляр приложения, возвращает ErrLocked. При ошибке result содержит
+// то, что успело удалиться
+func (r *Reaper) Reap(ctx context.Context) (result ReapResult, err error) {
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	// истекшие сниппеты владелец ещё видит у себя в списке, поэтому
+	// они живут столько же, сколько удалённые в корзине
+	cutoff := trashCutoff()
+	for {
+		n, err := r.purgeSnippets(ctx, cutoff)
+		result.Snippets += n
+		if err != nil {
+			return result, err
+		}
+		if n < r.BatchSize {
+			break
+		}
+	}
+
+	// строки этих таблиц не нужны после expires
+	now := time.Now().UTC()
+	for _, t := range []struct {
+		table, key string
+		count      *int
+	}{
+		{"refresh_tokens", "id", &result.RefreshTokens},
+		{"access_tokens", "jti", &result.AccessTokens},
+		{"revoked_tokens", "jti", &result.RevokedTokens},
+		{"token_versions", "user_id", &result.TokenVersions},
+	} {
+		for {
+			n, err := r.purgeExpired(ctx, t.table, t.key, now)
+			*t.count += n
+			if err != nil {
+				return result, err
+			}
+			if n < r.BatchSize {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// lock берёт advisory lock на отдельном соединении: блокировка сессионная
+// и снимается только на том же соединении. В SQLite с файлом работает
+// один процесс, поэтому блокировка не нужна
+func (r *Reaper) lock(ctx context.Context) (unlock func(), err error) {
+	if r.Dialect == SQLite {
+		return func() {}, nil
+	}
+
+	conn, err := r.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, reaperLockKey).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		if err == nil {
+			err = ErrLocked
+		}
+		return nil, err
+	}
+
+	return func() {
+		// ctx к этому моменту может быть уже отменён
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, reaperLockKey)
+		if err != nil {
+			// соединение с неснятой блокировкой нельзя возвращать в пул
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
+
+func (r *Reaper) purgeSnippets(ctx context.Context, cutoff time.Time) (_ int, err error) {
+	ctx, done := withTimeout(ctx, r.Timeout)
+	defer done(&err)
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT id FROM snippets WHERE expires < $1 OR deleted < $1
+	ORDER BY id LIMIT $2`
+	rows, err := tx.QueryContext(ctx, stmt, cutoff, r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	ids := []any{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	in := placeholders(len(ids))
+	for _, stmt := range []string{
+		`DELETE FROM snippet_revisions WHERE snippet_id IN ` + in,
+		`DELETE FROM snippet_tags WHERE snippet_id IN ` + in,
+		`DELETE FROM snippets WHERE id IN ` + in,
+	} {
+		if _, err = tx.ExecContext(ctx, stmt, ids...); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// purgeExpired удаляет из table до BatchSize строк, истекших раньше now.
+// key - первичный ключ table
+func (r *Reaper) purgeExpired(ctx context.Context, table, key string, now time.Time) (_ int, err error) {
+	ctx, done := withTimeout(ctx, r.Timeout)
+	defer done(&err)
+
+	stmt := fmt.Sprintf(`DELETE FROM %[1]s WHERE %[2]s IN
+	(SELECT %[2]s FROM %[1]s WHERE expires < $1 LIMIT $2)`, table, key)
+	result, err := r.DB.ExecContext(ctx, stmt, now, r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// placeholders возвращает список параметров ($1, $2, ..., $n) для IN
+func placeholders(n int) string {
+	var b strings.Builder
+	b.WriteString("(")
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			b.WriteString(", ")
+		}
+		b.WriteString("$" + strconv.Itoa(i))
+	}
+	b.WriteString(")")
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestReaperSQLite(t *testing.T) {
+	db := newTestDB(t)
+	snippets := &SnippetModel{DB: db, Dialect: SQLite}
+	tokens := &RefreshTokenModel{DB: db}
+	ctx := context.Background()
+
+	userID := newTestUser(t, db, "alice@example.com")
+	otherID := newTestUser(t, db, "bob@example.com")
+
+	ids := []int{}
+	for i := 0; i < 4; i++ {
+		id, err := snippets.Insert(ctx, "Snippet", "Content", 7, userID, []string{"tag"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	old := time.Now().UTC().AddDate(0, 0, -TrashRetention-1)
+	// давно истекший, давно удалённый, недавно удалённый и активный
+	if _, err := db.Exec(`UPDATE snippets SET expires = $1 WHERE id = $2`, old, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE snippets SET deleted = $1 WHERE id = $2`, old, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := snippets.Delete(ctx, ids[2], userID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tokens.Insert(ctx, "expired", -1, userID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Insert(ctx, "valid", 1, otherID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	reaper := &Reaper{DB: db, Dialect: SQLite, BatchSize: 1}
+	result, err := reaper.Reap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, result.Snippets, 2)
+	assert.Equal(t, result.RefreshTokens, 1)
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM snippets`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, count, 2)
+	if err := db.QueryRow(`SELECT COUNT(*) FROM snippet_revisions`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, count, 2)
+
+	_, _, err = tokens.Rotate(ctx, "valid", "valid-next", 1, "")
+	assert.Equal(t, err, nil)
+
+	result, err = reaper.Reap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, result, ReapResult{})
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -10,58 +13,168 @@ import (
 	"snippetbox.glebich/internal/jwtAuth"
 )
 
+// RotationGrace - сколько заменённый refresh токен ещё принимается. Браузер может
+// отправить несколько запросов со старым токеном, пока не получил новый
+const RotationGrace = 30 * time.Second
+
+// RefreshToken - refresh токен одной сессии пользователя на одном устройстве.
+// Сам токен есть только в куке, в БД лежит его хеш. Сессию определяет
+// FamilyID: при обмене токен заменяется новым из того же семейства
 type RefreshToken struct {
-	ID      int
-	Value   string
-	UserId  int
-	Expires time.Time
+	ID        int
+	FamilyID  int
+	Hash      string
+	UserId    int
+	Expires   time.Time
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastUsed  time.Time
+}
+
+type RefreshTokenModelInterface interface {
+	Insert(ctx context.Context, value string, expires int, userId int, userAgent, ip string) error
+	Rotate(ctx context.Context, value, newValue string, expires int, ip string) (*jwtAuth.Sub, bool, error)
+	Get(ctx context.Context, value string) (*RefreshToken, error)
+	SetAccessToken(ctx context.Context, value, jti string, expires time.Time) error
+	Sessions(ctx context.Context, userId int) ([]*RefreshToken, error)
+	Revoke(ctx context.Context, familyID int, userId int) error
+	RevokeOthers(ctx context.Context, familyID int, userId int) error
+	Delete(ctx context.Context, userId int) error
 }
 
 type RefreshTokenModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Timeout time.Duration
 }
 
-func (m *RefreshTokenModel) Insert(value string, expires int, userId int) error {
-	/*
-		hashedRefreshToken, err := bcrypt.GenerateFromPassword([]byte(value), 12)
-		if err != nil {
-			return err
-		}
-	*/
+// Insert открывает новую сессию. Остальные сессии пользователя
+// (на других устройствах) при этом не трогаются
+func (m *RefreshTokenModel) Insert(ctx context.Context, value string, expires int, userId int, userAgent, ip string) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
 
-	// думаю, потом лучше будет перенести удаление истекших токенов на БД
-	stmt := `INSERT INTO refresh_tokens(value, expires, user_id) 
-	VALUES($1, CURRENT_TIMESTAMP + $2 * INTERVAL '1 day', $3)`
-	_, err := m.DB.Exec(stmt, value, expires, userId)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key value") {
-			if err = m.Delete(userId); err != nil {
-				return err
-			}
-			if _, err = m.DB.Exec(stmt, value, expires, userId); err != nil {
-				return err
-			}
-		}
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	// истекшие токены удаляет Reaper
+	stmt := `INSERT INTO refresh_tokens(hash, family_id, expires, user_id, user_agent, ip, created, last_used)
+	VALUES($1, 0, $2, $3, $4, $5, $6, $6)
+	RETURNING id`
+	now := time.Now().UTC()
+	var id int
+	err = tx.QueryRowContext(ctx, stmt, HashToken(value), now.AddDate(0, 0, expires), userId, userAgent, ip, now).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	// первый токен сессии начинает новое семейство
+	if _, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET family_id = id WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (m *RefreshTokenModel) CheckRefreshToken(value string) (*jwtAuth.Sub, error) {
-	/*
-		hashedRefreshToken, err := bcrypt.GenerateFromPassword([]byte(value), 12)
+// Rotate обменивает refresh токен value на newValue, который действует expires
+// дней, и возвращает владельца сессии. rotated = false, если токен уже заменили
+// не дольше RotationGrace назад: пользователь остаётся в сессии, но newValue
+// не сохраняется и выдавать его не нужно. Если заменённый токен пришёл позже,
+// значит, им пользуется кто-то ещё - вся сессия завершается и возвращается ErrTokenReused
+func (m *RefreshTokenModel) Rotate(ctx context.Context, value, newValue string, expires int, ip string) (_ *jwtAuth.Sub, rotated bool, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT t.id, t.family_id, t.expires, t.rotated, t.user_agent, t.created,
+		u.id, u.name, u.email, u.roles, u.token_version
+	FROM refresh_tokens t JOIN users u ON u.id = t.user_id
+	WHERE t.hash = $1`
+
+	var (
+		old       RefreshToken
+		rotatedAt sql.NullTime
+		roles     string
+	)
+	user := &jwtAuth.Sub{}
+	err = tx.QueryRowContext(ctx, stmt, HashToken(value)).Scan(&old.ID, &old.FamilyID, &old.Expires, &rotatedAt,
+		&old.UserAgent, &old.Created, &user.ID, &user.Name, &user.Email, &roles, &user.TokenVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, ErrNoRecord
+		} else {
+			return nil, false, err
+		}
+	}
+
+	user.Roles = strings.Fields(roles)
+
+	now := time.Now().UTC()
+	if old.Expires.Before(now) {
+		return nil, false, fmt.Errorf("expired token")
+	}
+
+	if rotatedAt.Valid {
+		if now.Sub(rotatedAt.Time) <= RotationGrace {
+			return user, false, nil
+		}
+		if err = revokeSessionAccess(ctx, tx, `family_id = $2`, old.FamilyID); err != nil {
+			return nil, false, err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE family_id = $1`, old.FamilyID)
 		if err != nil {
-			return nil, err
+			return nil, false, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, false, err
 		}
-	*/
-	stmt := `SELECT value, user_id, expires FROM refresh_tokens WHERE value = $1`
+		return nil, false, fmt.Errorf("%w: user %d, session %d", ErrTokenReused, user.ID, old.FamilyID)
+	}
 
-	var row struct {
-		hashedRefreshTokenFromDB string
-		userId                   int
-		expires                  time.Time
+	// условие на rotated - на случай, если параллельный запрос успел заменить токен раньше
+	result, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET rotated = $1 WHERE id = $2 AND rotated IS NULL`, now, old.ID)
+	if err != nil {
+		return nil, false, err
 	}
-	err := m.DB.QueryRow(stmt, value).Scan(&row.hashedRefreshTokenFromDB, &row.userId, &row.expires)
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if n == 0 {
+		return user, false, nil
+	}
+
+	stmt = `INSERT INTO refresh_tokens(hash, family_id, expires, user_id, user_agent, ip, created, last_used)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.ExecContext(ctx, stmt, HashToken(newValue), old.FamilyID, now.AddDate(0, 0, expires),
+		user.ID, old.UserAgent, ip, old.Created, now)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return user, true, nil
+}
+
+// Get возвращает сессию по значению токена из куки
+func (m *RefreshTokenModel) Get(ctx context.Context, value string) (_ *RefreshToken, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT id, family_id, user_id, expires, user_agent, ip, created, last_used
+	FROM refresh_tokens WHERE hash = $1 AND expires > $2`
+	t := &RefreshToken{}
+	err = m.DB.QueryRowContext(ctx, stmt, HashToken(value), time.Now().UTC()).
+		Scan(&t.ID, &t.FamilyID, &t.UserId, &t.Expires, &t.UserAgent, &t.IP, &t.Created, &t.LastUsed)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -69,33 +182,127 @@ func (m *RefreshTokenModel) CheckRefreshToken(value string) (*jwtAuth.Sub, error
 			return nil, err
 		}
 	}
+	return t, nil
+}
 
-	if row.expires.Unix() < time.Now().Unix() {
-		m.Delete(row.userId)
-		return nil, fmt.Errorf("expired token")
-	}
+// SetAccessToken запоминает access токен jti, выданный по refresh токену value,
+// чтобы при завершении сессии его можно было отозвать. Запоминаются все
+// токены сессии, а не только последний
+func (m *RefreshTokenModel) SetAccessToken(ctx context.Context, value, jti string, expires time.Time) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
 
-	stmt = `SELECT id, name, email FROM users WHERE id = $1`
+	stmt := `INSERT INTO access_tokens(jti, family_id, user_id, expires)
+	SELECT $1, family_id, user_id, $2 FROM refresh_tokens WHERE hash = $3`
+	_, err = m.DB.ExecContext(ctx, stmt, jti, expires.UTC(), HashToken(value))
+	return err
+}
 
-	user := &jwtAuth.Sub{}
-	err = m.DB.QueryRow(stmt, row.userId).Scan(&user.ID, &user.Name, &user.Email)
+// Sessions возвращает действующие сессии пользователя (последний токен
+// каждого семейства), начиная с последней использованной. Hash не заполняется
+func (m *RefreshTokenModel) Sessions(ctx context.Context, userId int) (_ []*RefreshToken, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT id, family_id, user_id, expires, user_agent, ip, created, last_used
+	FROM refresh_tokens WHERE user_id = $1 AND rotated IS NULL AND expires > $2
+	ORDER BY last_used DESC, id DESC`
+	rows, err := m.DB.QueryContext(ctx, stmt, userId, time.Now().UTC())
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	sessions := []*RefreshToken{}
+	for rows.Next() {
+		t := &RefreshToken{}
+		err := rows.Scan(&t.ID, &t.FamilyID, &t.UserId, &t.Expires, &t.UserAgent, &t.IP, &t.Created, &t.LastUsed)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Revoke завершает сессию familyID и отзывает её access токены.
+// Чужую сессию завершить нельзя - ErrNoRecord
+func (m *RefreshTokenModel) Revoke(ctx context.Context, familyID int, userId int) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
 
-	return user, nil
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = revokeSessionAccess(ctx, tx, `family_id = $2 AND user_id = $3`, familyID, userId); err != nil {
+		return err
+	}
+	stmt := `DELETE FROM refresh_tokens WHERE family_id = $1 AND user_id = $2`
+	result, err := tx.ExecContext(ctx, stmt, familyID, userId)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return tx.Commit()
 }
 
-func (m *RefreshTokenModel) Delete(userId int) error {
-	stmt := `DELETE FROM refresh_tokens WHERE user_id = $1`
-	_, err := m.DB.Exec(stmt, userId)
+// RevokeOthers завершает все сессии пользователя, кроме familyID
+func (m *RefreshTokenModel) RevokeOthers(ctx context.Context, familyID int, userId int) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = revokeSessionAccess(ctx, tx, `user_id = $2 AND family_id <> $3`, userId, familyID); err != nil {
+		return err
+	}
+	stmt := `DELETE FROM refresh_tokens WHERE user_id = $1 AND family_id <> $2`
+	if _, err = tx.ExecContext(ctx, stmt, userId, familyID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete завершает все сессии пользователя
+func (m *RefreshTokenModel) Delete(ctx context.Context, userId int) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	if err = revokeSessionAccess(ctx, tx, `user_id = $2`, userId); err != nil {
+		return err
+	}
+	stmt := `DELETE FROM refresh_tokens WHERE user_id = $1`
+	if _, err = tx.ExecContext(ctx, stmt, userId); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-/*
-CREATE TABLE refresh_tokens (id SERIAL PRIMARY KEY, value CHAR(60) NOT NULL, expires TIMESTAMP NOT NULL, user_id INTEGER NOT NULL UNIQUE, FOREIGN KEY (user_id) REFERENCES users(id));
-// либо можно составной первичный ключ
-*/
+// HashToken - то, что хранится в БД вместо refresh токена. Токен - 128 случайных
+// бит, подобрать его по хешу нельзя, поэтому медленный хеш с солью
+// вроде bcrypt не нужен, а SHA-256 позволяет искать сессию по индексу
+func HashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestRefreshTokenSessionsSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &RefreshTokenModel{DB: db}
+	ctx := context.Background()
+
+	userID := newTestUser(t, db, "alice@example.com")
+	otherID := newTestUser(t, db, "bob@example.com")
+
+	for _, value := range []string{"laptop", "desktop", "phone"} {
+		if err := m.Insert(ctx, value, 1, userID, value+" browser", "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Insert(ctx, "other", 1, otherID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// вход на новом устройстве не завершает остальные сессии
+	user, rotated, err := m.Rotate(ctx, "laptop", "laptop-next", 1, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.ID, userID)
+	assert.Equal(t, rotated, true)
+
+	sessions, err := m.Sessions(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(sessions), 3)
+	// laptop только что использовался
+	assert.Equal(t, sessions[0].UserAgent, "laptop browser")
+	assert.Equal(t, sessions[0].IP, "192.0.2.1")
+
+	desktop, err := m.Get(ctx, "desktop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, errors.Is(m.Revoke(ctx, desktop.FamilyID, otherID), ErrNoRecord), true)
+	assert.Equal(t, m.Revoke(ctx, desktop.FamilyID, userID), nil)
+	_, _, err = m.Rotate(ctx, "desktop", "desktop-next", 1, "")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	laptop, err := m.Get(ctx, "laptop-next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, m.RevokeOthers(ctx, laptop.FamilyID, userID), nil)
+	sessions, err = m.Sessions(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(sessions), 1)
+	assert.Equal(t, sessions[0].ID, laptop.ID)
+
+	_, _, err = m.Rotate(ctx, "other", "other-next", 1, "")
+	assert.Equal(t, err, nil)
+}
+
+func TestRefreshTokenHashedSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &RefreshTokenModel{DB: db}
+	ctx := context.Background()
+
+	userID := newTestUser(t, db, "alice@example.com")
+	if err := m.Insert(ctx, "secret-token", 1, userID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// в БД нет самого токена, только его хеш
+	var stored string
+	if err := db.QueryRow(`SELECT hash FROM refresh_tokens`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, stored, HashToken("secret-token"))
+	assert.Equal(t, len(stored), 64)
+
+	user, err := m.Get(ctx, "secret-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.UserId, userID)
+
+	_, err = m.Get(ctx, stored)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestRefreshTokenRotationSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &RefreshTokenModel{DB: db}
+	ctx := context.Background()
+
+	userID := newTestUser(t, db, "alice@example.com")
+	if err := m.Insert(ctx, "first", 1, userID, "laptop browser", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := m.Get(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, first.FamilyID, first.ID)
+
+	_, rotated, err := m.Rotate(ctx, "first", "second", 1, "192.0.2.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rotated, true)
+
+	// новый токен продолжает ту же сессию
+	second, err := m.Get(ctx, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, second.FamilyID, first.FamilyID)
+	assert.Equal(t, second.UserAgent, "laptop browser")
+	assert.Equal(t, second.IP, "192.0.2.2")
+	sessions, err := m.Sessions(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(sessions), 1)
+	assert.Equal(t, sessions[0].ID, second.ID)
+
+	t.Run("Within grace period", func(t *testing.T) {
+		user, rotated, err := m.Rotate(ctx, "first", "ignored", 1, "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, user.ID, userID)
+		assert.Equal(t, rotated, false)
+		_, err = m.Get(ctx, "ignored")
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Reuse after grace period", func(t *testing.T) {
+		_, err := db.Exec(`UPDATE refresh_tokens SET rotated = $1 WHERE id = $2`,
+			time.Now().UTC().Add(-2*RotationGrace), first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = m.Rotate(ctx, "first", "stolen", 1, "198.51.100.1")
+		assert.Equal(t, errors.Is(err, ErrTokenReused), true)
+
+		// вся сессия завершена, вместе с токеном законного владельца
+		_, _, err = m.Rotate(ctx, "second", "third", 1, "192.0.2.2")
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+		sessions, err := m.Sessions(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 0)
+	})
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Revision - неизменяемый снимок сниппета после очередной правки
+type Revision struct {
+	SnippetID int
+	Number    int
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+func insertRevision(ctx context.Context, tx *sql.Tx, snippetID, number int, title, content string) error {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, revision, title, content, created)
+	VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.ExecContext(ctx, stmt, snippetID, number, title, content, time.Now().UTC())
+	return err
+}
+
+// GetRevision возвращает сниппет в том виде, в котором он был в ревизии number
+func (m *SnippetModel) GetRevision(ctx context.Context, id int, number int) (_ *Snippet, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT s.id, COALESCE(s.user_id, 0), r.title, r.content, r.revision, s.created, s.expires
+	FROM snippets s JOIN snippet_revisions r ON r.snippet_id = s.id
+	WHERE s.deleted IS NULL AND s.expires > $1
+	AND s.id = $2 AND r.revision = $3`
+	row := m.DB.QueryRowContext(ctx, stmt, time.Now().UTC(), id, number)
+	s := &Snippet{}
+	err = row.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Revision, &s.Created, &s.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	if s.Tags, err = m.tags(ctx, s.ID); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Revisions возвращает историю правок сниппета, начиная с последней
+func (m *SnippetModel) Revisions(ctx context.Context, id int) (_ []*Revision, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT snippet_id, revision, title, content, created FROM snippet_revisions
+	WHERE snippet_id = $1 ORDER BY revision DESC`
+	rows, err := m.DB.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []*Revision{}
+	for rows.Next() {
+		r := &Revision{}
+		err := rows.Scan(&r.SnippetID, &r.Number, &r.Title, &r.Content, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
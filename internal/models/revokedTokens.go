@@ -0,0 +1,254 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// syncOverlap - насколько раньше прошлой синхронизации RevokedTokenModel.Sync
+// ищет новые записи: часы экземпляров приложения могут немного расходиться
+const syncOverlap = time.Minute
+
+// RevokedToken - access токен, отозванный до истечения срока действия
+type RevokedToken struct {
+	JTI     string
+	UserId  int // 0 - владелец неизвестен (отозван администратором по jti)
+	Expires time.Time
+	Revoked time.Time
+}
+
+type RevokedTokenModelInterface interface {
+	Revoke(ctx context.Context, jti string, userId int, expires time.Time) error
+	IsRevoked(jti string) bool
+	RevokeVersion(ctx context.Context, userId, version int, expires time.Time) error
+	MinVersion(userId int) int
+	Sync(ctx context.Context) error
+	Recent(ctx context.Context, limit int) ([]*RevokedToken, error)
+}
+
+// RevokedTokenModel - список отозванных access токенов и версий токенов
+// пользователей, сменивших пароль. Проверка идёт по копии списка в памяти,
+// чтобы не ходить в БД на каждый запрос. Отзывы, сделанные другими
+// экземплярами приложения или при завершении сессий в RefreshTokenModel,
+// попадают в память при следующем Sync
+type RevokedTokenModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+
+	mu       sync.RWMutex
+	revoked  map[string]time.Time // jti -> когда токен истекает сам
+	versions map[int]tokenVersion // id пользователя -> наименьшая действующая версия
+	synced   time.Time
+}
+
+// tokenVersion - версия токенов пользователя и время, когда истекут
+// все JWT с меньшей версией
+type tokenVersion struct {
+	version int
+	expires time.Time
+}
+
+// Revoke отзывает токен jti, который иначе действовал бы до expires
+func (m *RevokedTokenModel) Revoke(ctx context.Context, jti string, userId int, expires time.Time) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	user := sql.NullInt64{Int64: int64(userId), Valid: userId > 0}
+	stmt := `INSERT INTO revoked_tokens(jti, user_id, expires, revoked)
+	VALUES($1, $2, $3, $4)
+	ON CONFLICT (jti) DO NOTHING`
+	_, err = m.DB.ExecContext(ctx, stmt, jti, user, expires.UTC(), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.revoked == nil {
+		m.revoked = map[string]time.Time{}
+	}
+	m.revoked[jti] = expires
+	return nil
+}
+
+// IsRevoked сообщает, отозван ли токен jti. Смотрит только в память
+func (m *RevokedTokenModel) IsRevoked(jti string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.revoked[jti]
+	return ok
+}
+
+// RevokeVersion отзывает все JWT пользователя userId с версией меньше version.
+// expires - когда они истекут сами: позже now + время жизни JWT
+func (m *RevokedTokenModel) RevokeVersion(ctx context.Context, userId, version int, expires time.Time) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	// версия только растёт, даже если смены пароля записываются не по порядку
+	stmt := `INSERT INTO token_versions(user_id, version, expires, changed)
+	VALUES($1, $2, $3, $4)
+	ON CONFLICT (user_id) DO UPDATE
+	SET version = excluded.version, expires = excluded.expires, changed = excluded.changed
+	WHERE token_versions.version < excluded.version`
+	_, err = m.DB.ExecContext(ctx, stmt, userId, version, expires.UTC(), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setVersion(userId, tokenVersion{version: version, expires: expires})
+	return nil
+}
+
+// MinVersion возвращает наименьшую версию JWT пользователя userId, которая
+// ещё принимается, 0 - любую. Смотрит только в память
+func (m *RevokedTokenModel) MinVersion(userId int) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.versions[userId].version
+}
+
+// setVersion запоминает версию v, если она больше известной. Вызывается под mu
+func (m *RevokedTokenModel) setVersion(userId int, v tokenVersion) {
+	if m.versions == nil {
+		m.versions = map[int]tokenVersion{}
+	}
+	if v.version > m.versions[userId].version {
+		m.versions[userId] = v
+	}
+}
+
+// Sync загружает из БД отзывы и версии токенов, появившиеся после прошлой
+// синхронизации (при первом вызове - все действующие), и забывает истекшие
+func (m *RevokedTokenModel) Sync(ctx context.Context) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	m.mu.RLock()
+	since := m.synced
+	m.mu.RUnlock()
+	if !since.IsZero() {
+		since = since.Add(-syncOverlap)
+	}
+
+	now := time.Now().UTC()
+	stmt := `SELECT jti, expires FROM revoked_tokens WHERE revoked >= $1 AND expires > $2`
+	rows, err := m.DB.QueryContext(ctx, stmt, since, now)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	loaded := map[string]time.Time{}
+	for rows.Next() {
+		var (
+			jti     string
+			expires time.Time
+		)
+		if err := rows.Scan(&jti, &expires); err != nil {
+			return err
+		}
+		loaded[jti] = expires
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt = `SELECT user_id, version, expires FROM token_versions WHERE changed >= $1 AND expires > $2`
+	versionRows, err := m.DB.QueryContext(ctx, stmt, since, now)
+	if err != nil {
+		return err
+	}
+	defer versionRows.Close()
+	versions := map[int]tokenVersion{}
+	for versionRows.Next() {
+		var (
+			userId int
+			v      tokenVersion
+		)
+		if err := versionRows.Scan(&userId, &v.version, &v.expires); err != nil {
+			return err
+		}
+		versions[userId] = v
+	}
+	if err := versionRows.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.revoked == nil {
+		m.revoked = map[string]time.Time{}
+	}
+	for jti, expires := range loaded {
+		m.revoked[jti] = expires
+	}
+	for jti, expires := range m.revoked {
+		if expires.Before(now) {
+			delete(m.revoked, jti)
+		}
+	}
+	for userId, v := range versions {
+		m.setVersion(userId, v)
+	}
+	for userId, v := range m.versions {
+		if v.expires.Before(now) {
+			delete(m.versions, userId)
+		}
+	}
+	m.synced = now
+	return nil
+}
+
+// Recent возвращает последние limit отозванных и ещё не истекших токенов
+func (m *RevokedTokenModel) Recent(ctx context.Context, limit int) (_ []*RevokedToken, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT jti, user_id, expires, revoked FROM revoked_tokens
+	WHERE expires > $1
+	ORDER BY revoked DESC, jti
+	LIMIT $2`
+	rows, err := m.DB.QueryContext(ctx, stmt, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []*RevokedToken{}
+	for rows.Next() {
+		t := &RevokedToken{}
+		var user sql.NullInt64
+		err := rows.Scan(&t.JTI, &user, &t.Expires, &t.Revoked)
+		if err != nil {
+			return nil, err
+		}
+		t.UserId = int(user.Int64)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// execer - то общее, что есть у *sql.DB и *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// revokeSessionAccess отзывает ещё действующие access токены, выданные
+// сессиям, которые подходят под cond - условие на family_id и user_id.
+// Параметры cond начинаются с $2 ($1 - текущее время)
+func revokeSessionAccess(ctx context.Context, db execer, cond string, args ...any) error {
+	stmt := `INSERT INTO revoked_tokens(jti, user_id, expires, revoked)
+	SELECT jti, user_id, expires, $1 FROM access_tokens
+	WHERE ` + cond + ` AND expires > $1
+	ON CONFLICT (jti) DO NOTHING`
+	_, err := db.ExecContext(ctx, stmt, append([]any{time.Now().UTC()}, args...)...)
+	return err
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestRevokedTokensSQLite(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "alice@example.com")
+
+	// два экземпляра приложения с общей БД
+	first := &RevokedTokenModel{DB: db}
+	second := &RevokedTokenModel{DB: db}
+	if err := second.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(time.Minute)
+	if err := first.Revoke(ctx, "jti-1", userID, expires); err != nil {
+		t.Fatal(err)
+	}
+	// повторный отзыв не ошибка
+	assert.Equal(t, first.Revoke(ctx, "jti-1", userID, expires), nil)
+	assert.Equal(t, first.IsRevoked("jti-1"), true)
+	assert.Equal(t, second.IsRevoked("jti-1"), false)
+
+	if err := second.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, second.IsRevoked("jti-1"), true)
+
+	t.Run("Session revoke", func(t *testing.T) {
+		tokens := &RefreshTokenModel{DB: db}
+		if err := tokens.Insert(ctx, "laptop", 1, userID, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := tokens.SetAccessToken(ctx, "laptop", "jti-laptop", expires); err != nil {
+			t.Fatal(err)
+		}
+		laptop, err := tokens.Get(ctx, "laptop")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// после обмена JWT получает и новый токен, и параллельный запрос со старым
+		if _, _, err := tokens.Rotate(ctx, "laptop", "laptop-2", 1, ""); err != nil {
+			t.Fatal(err)
+		}
+		for value, jti := range map[string]string{"laptop-2": "jti-laptop-2", "laptop": "jti-grace"} {
+			if err := tokens.SetAccessToken(ctx, value, jti, expires); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := tokens.Revoke(ctx, laptop.FamilyID, userID); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, second.IsRevoked("jti-laptop"), false)
+		if err := second.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, second.IsRevoked("jti-laptop"), true)
+		assert.Equal(t, second.IsRevoked("jti-laptop-2"), true)
+		assert.Equal(t, second.IsRevoked("jti-grace"), true)
+
+		recent, err := first.Recent(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(recent), 4)
+		assert.Equal(t, recent[0].UserId, userID)
+	})
+
+	t.Run("Token version", func(t *testing.T) {
+		assert.Equal(t, first.MinVersion(userID), 0)
+		if err := first.RevokeVersion(ctx, userID, 3, expires); err != nil {
+			t.Fatal(err)
+		}
+		// более старая смена пароля не понижает версию
+		if err := first.RevokeVersion(ctx, userID, 2, expires); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, first.MinVersion(userID), 3)
+		assert.Equal(t, second.MinVersion(userID), 0)
+
+		if err := second.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, second.MinVersion(userID), 3)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		if err := first.Revoke(ctx, "jti-old", 0, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := first.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, first.IsRevoked("jti-old"), false)
+
+		oldUser := newTestUser(t, db, "bob@example.com")
+		if err := first.RevokeVersion(ctx, oldUser, 2, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := first.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, first.MinVersion(oldUser), 0)
+
+		reaper := &Reaper{DB: db, Dialect: SQLite, BatchSize: 10}
+		result, err := reaper.Reap(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, result.RevokedTokens, 1)
+		assert.Equal(t, result.TokenVersions, 1)
+	})
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// маркеры, которыми ts_headline обрамляет найденные слова. Это управляющие
+// символы, а не html-теги, чтобы содержимое сниппета можно было
+// безопасно экранировать уже после выделения
+const (
+	HighlightStart = "\x02"
+	HighlightStop  = "\x03"
+)
+
+// SearchResult - найденный сниппет с релевантностью и фрагментом текста,
+// в котором найденные слова обрамлены HighlightStart/HighlightStop
+type SearchResult struct {
+	Snippet  *Snippet
+	Rank     float64
+	Headline string
+}
+
+// Search ищет активные сниппеты по словам из query. Совпадения в заголовке
+// весят больше, чем в тексте. page начинается с 1; more сообщает,
+// есть ли следующая страница
+func (m *SnippetModel) Search(ctx context.Context, query string, page, limit int) (results []*SearchResult, more bool, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	var (
+		stmt string
+		args []any
+	)
+	now := time.Now().UTC()
+	switch m.Dialect {
+	case SQLite:
+		query = ftsQuery(query)
+		if query == "" {
+			return []*SearchResult{}, false, nil
+		}
+		// bm25 тем меньше, чем лучше совпадение, поэтому знак меняется
+		stmt = `SELECT s.id, COALESCE(s.user_id, 0), s.title, s.content, s.revision, s.created, s.expires,
+		-bm25(snippets_fts, 10.0, 1.0) AS rank, snippet(snippets_fts, 1, $2, $3, '…', 30)
+		FROM snippets_fts JOIN snippets s ON s.id = snippets_fts.rowid
+		WHERE snippets_fts MATCH $1 AND s.deleted IS NULL AND s.expires > $4
+		ORDER BY rank DESC, s.id DESC
+		LIMIT $5 OFFSET $6`
+		args = []any{query, HighlightStart, HighlightStop, now, limit + 1, (page - 1) * limit}
+	default:
+		// синтаксис как у поисковиков: "фраза", -исключение, or
+		headlineOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=30, MinWords=10",
+			HighlightStart, HighlightStop)
+		stmt = `SELECT id, COALESCE(user_id, 0), title, content, revision, created, expires,
+		ts_rank(search, query) AS rank, ts_headline('simple', content, query, $2)
+		FROM snippets, websearch_to_tsquery('simple', $1) query
+		WHERE search @@ query AND deleted IS NULL AND expires > $3
+		ORDER BY rank DESC, id DESC
+		LIMIT $4 OFFSET $5`
+		args = []any{query, headlineOptions, now, limit + 1, (page - 1) * limit}
+	}
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	results = []*SearchResult{}
+	for rows.Next() {
+		s := &Snippet{}
+		r := &SearchResult{Snippet: s}
+		err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Revision, &s.Created, &s.Expires, &r.Rank, &r.Headline)
+		if err != nil {
+			return nil, false, err
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if len(results) > limit {
+		return results[:limit], true, nil
+	}
+	return results, false, nil
+}
+
+// ftsQuery превращает пользовательский запрос в запрос FTS5: каждое слово
+// берётся в кавычки, чтобы спецсимволы не ломали синтаксис MATCH,
+// и все слова должны встретиться в сниппете
+func ftsQuery(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
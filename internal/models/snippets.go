@@ -1,42 +1,133 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 )
 
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID       int
+	UserID   int
+	Title    string
+	Content  string
+	Revision int
+	Created  time.Time
+	Expires  time.Time
+	Deleted  time.Time
+	Tags     []string
+}
+
+// TrashRetention - сколько дней удалённый сниппет можно восстановить из корзины
+const TrashRetention = 30
+
+type SnippetModelInterface interface {
+	Insert(ctx context.Context, title string, content string, expires int, userID int, tags []string) (int, error)
+	Update(ctx context.Context, id int, userID int, title string, content string) (int, error)
+	Get(ctx context.Context, id int) (*Snippet, error)
+	GetRevision(ctx context.Context, id int, number int) (*Snippet, error)
+	Revisions(ctx context.Context, id int) ([]*Revision, error)
+	List(ctx context.Context, cursor Cursor, limit int) (*SnippetPage, error)
+	ByUser(ctx context.Context, userID int) ([]*Snippet, error)
+	ByTag(ctx context.Context, tag string, cursor Cursor, limit int) (*SnippetPage, error)
+	TagCloud(ctx context.Context, limit int) ([]*TagCount, error)
+	Search(ctx context.Context, query string, page, limit int) ([]*SearchResult, bool, error)
+	Delete(ctx context.Context, id int, userID int) error
+	Restore(ctx context.Context, id int, userID int) error
+	Purge(ctx context.Context, id int, userID int) error
+	Trash(ctx context.Context, userID int) ([]*Snippet, error)
 }
 
 type SnippetModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
+	// Timeout ограничивает время одного обращения к БД, 0 - без ограничения
+	Timeout time.Duration
 }
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires) 
-	VALUES ($1, $2, CURRENT_TIMESTAMP AT TIME ZONE 'UTC', CURRENT_TIMESTAMP + $3 * INTERVAL '1 day')
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, expires int, userID int, tags []string) (_ int, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	stmt := `INSERT INTO snippets (title, content, created, expires, user_id, revision) 
+	VALUES ($1, $2, $3, $4, $5, 1)
 	RETURNING id`
 	//result, err := m.DB.Exec(stmt, title, content, expires)
 	var id int64
-	err := m.DB.QueryRow(stmt, title, content, expires).Scan(&id)
+	err = tx.QueryRowContext(ctx, stmt, title, content, now, now.AddDate(0, 0, expires), userID).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
+
+	// первая ревизия - это исходный текст сниппета
+	if err = insertRevision(ctx, tx, int(id), 1, title, content); err != nil {
+		return 0, err
+	}
+
+	if err = insertTags(ctx, tx, int(id), tags); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
 	return int(id), nil
 }
 
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > CURRENT_TIMESTAMP AT TIME ZONE 'UTC' AND id = $1`
-	row := m.DB.QueryRow(stmt, id)
+// Update меняет заголовок и содержимое сниппета и сохраняет изменение
+// как новую ревизию. Править можно только свои и ещё не истекшие сниппеты,
+// иначе возвращается ErrNoRecord
+func (m *SnippetModel) Update(ctx context.Context, id int, userID int, title string, content string) (_ int, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET title = $1, content = $2, revision = revision + 1
+	WHERE id = $3 AND user_id = $4 AND deleted IS NULL AND expires > $5
+	RETURNING revision`
+	var revision int
+	err = tx.QueryRowContext(ctx, stmt, title, content, id, userID, time.Now().UTC()).Scan(&revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	if err = insertRevision(ctx, tx, id, revision, title, content); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+func (m *SnippetModel) Get(ctx context.Context, id int) (_ *Snippet, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	// у сниппетов, созданных до появления владельцев, user_id = NULL
+	stmt := `SELECT id, COALESCE(user_id, 0), title, content, revision, created, expires FROM snippets
+	WHERE deleted IS NULL AND expires > $1 AND id = $2`
+	row := m.DB.QueryRowContext(ctx, stmt, time.Now().UTC(), id)
 	s := &Snippet{}
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err = row.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Revision, &s.Created, &s.Expires)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -44,13 +135,114 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 			return nil, err
 		}
 	}
+	if s.Tags, err = m.tags(ctx, s.ID); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > CURRENT_TIMESTAMP AT TIME ZONE 'UTC' ORDER BY id DESC LIMIT 10`
-	rows, err := m.DB.Query(stmt)
+// List возвращает страницу активных сниппетов, от новых к старым.
+// Пагинация по id (keyset), поэтому новые сниппеты не сдвигают страницы
+func (m *SnippetModel) List(ctx context.Context, cursor Cursor, limit int) (_ *SnippetPage, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	return m.page(ctx, "", nil, cursor, limit)
+}
+
+// ByUser возвращает все сниппеты пользователя, включая истекшие,
+// чтобы на странице "My snippets" было видно и то, что уже недоступно по ссылке
+func (m *SnippetModel) ByUser(ctx context.Context, userID int) (_ []*Snippet, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT id, user_id, title, content, revision, created, expires FROM snippets
+	WHERE user_id = $1 AND deleted IS NULL ORDER BY id DESC`
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Revision, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// Delete переносит сниппет в корзину. Сниппет перестаёт быть виден,
+// но его можно восстановить в течение TrashRetention дней
+func (m *SnippetModel) Delete(ctx context.Context, id int, userID int) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `UPDATE snippets SET deleted = $1
+	WHERE id = $2 AND user_id = $3 AND deleted IS NULL`
+	return m.execOne(ctx, stmt, time.Now().UTC(), id, userID)
+}
+
+// Restore возвращает сниппет из корзины, если срок хранения ещё не вышел
+func (m *SnippetModel) Restore(ctx context.Context, id int, userID int) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `UPDATE snippets SET deleted = NULL
+	WHERE id = $1 AND user_id = $2 AND deleted > $3`
+	return m.execOne(ctx, stmt, id, userID, trashCutoff())
+}
+
+// Purge окончательно удаляет сниппет из корзины вместе со всеми ревизиями и тегами
+func (m *SnippetModel) Purge(ctx context.Context, id int, userID int) (err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"snippet_revisions", "snippet_tags"} {
+		stmt := `DELETE FROM ` + table + ` WHERE snippet_id IN
+		(SELECT id FROM snippets WHERE id = $1 AND user_id = $2 AND deleted IS NOT NULL)`
+		if _, err = tx.ExecContext(ctx, stmt, id, userID); err != nil {
+			return err
+		}
+	}
+
+	stmt := `DELETE FROM snippets WHERE id = $1 AND user_id = $2 AND deleted IS NOT NULL`
+	result, err := tx.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return tx.Commit()
+}
+
+// Trash возвращает сниппеты пользователя, которые лежат в корзине
+// и ещё могут быть восстановлены
+func (m *SnippetModel) Trash(ctx context.Context, userID int) (_ []*Snippet, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT id, user_id, title, content, revision, created, expires, deleted FROM snippets
+	WHERE user_id = $1 AND deleted > $2
+	ORDER BY deleted DESC`
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, trashCutoff())
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +250,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	snippets := []*Snippet{}
 	for rows.Next() {
 		s := &Snippet{}
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Revision, &s.Created, &s.Expires, &s.Deleted)
 		if err != nil {
 			return nil, err
 		}
@@ -69,3 +261,24 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	}
 	return snippets, nil
 }
+
+// trashCutoff - сниппеты, удалённые раньше этого момента, восстановить уже нельзя
+func trashCutoff() time.Time {
+	return time.Now().UTC().AddDate(0, 0, -TrashRetention)
+}
+
+// execOne выполняет запрос, который должен затронуть ровно одну строку
+func (m *SnippetModel) execOne(ctx context.Context, stmt string, args ...any) error {
+	result, err := m.DB.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestSnippetModelSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+	userID := newTestUser(t, db, "alice@example.com")
+
+	id, err := m.Insert(context.Background(), "An old silent pond", "A frog jumps into the pond", 7, userID, []string{"haiku", "nature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, s.Title, "An old silent pond")
+	assert.Equal(t, s.UserID, userID)
+	assert.Equal(t, s.Revision, 1)
+	assert.Equal(t, strings.Join(s.Tags, ","), "haiku,nature")
+	assert.Equal(t, s.Expires.After(s.Created), true)
+
+	revision, err := m.Update(context.Background(), id, userID, "Over the wintry forest", "Winds howl in rage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, revision, 2)
+
+	old, err := m.GetRevision(context.Background(), id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, old.Title, "An old silent pond")
+
+	_, err = m.Update(context.Background(), id, userID+1, "Stolen", "Stolen")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	page, err := m.ByTag(context.Background(), "haiku", Cursor{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(page.Snippets), 1)
+
+	assert.Equal(t, m.Delete(context.Background(), id, userID), nil)
+	_, err = m.Get(context.Background(), id)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	trash, err := m.Trash(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(trash), 1)
+
+	assert.Equal(t, m.Restore(context.Background(), id, userID), nil)
+	assert.Equal(t, m.Delete(context.Background(), id, userID), nil)
+	assert.Equal(t, m.Purge(context.Background(), id, userID), nil)
+	_, err = m.GetRevision(context.Background(), id, 1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestSnippetListSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+	userID := newTestUser(t, db, "alice@example.com")
+
+	for i := 0; i < 5; i++ {
+		if _, err := m.Insert(context.Background(), "Snippet", "Content", 1, userID, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := m.List(context.Background(), Cursor{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(first.Snippets), 2)
+	assert.Equal(t, first.Snippets[0].ID, 5)
+	assert.Equal(t, first.Next, 4)
+	assert.Equal(t, first.Prev, 0)
+
+	second, err := m.List(context.Background(), Cursor{After: first.Next}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, second.Snippets[0].ID, 3)
+	assert.Equal(t, second.Prev, 3)
+}
+
+func TestSnippetSearchSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite}
+	userID := newTestUser(t, db, "alice@example.com")
+
+	if _, err := m.Insert(context.Background(), "Frogs", "Nothing about the pond here", 7, userID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Insert(context.Background(), "Pond", "A frog jumps into the pond", 7, userID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results, more, err := m.Search(context.Background(), "pond", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, more, false)
+	assert.Equal(t, len(results), 2)
+	// совпадение в заголовке важнее
+	assert.Equal(t, results[0].Snippet.Title, "Pond")
+	assert.Equal(t, strings.Contains(results[0].Headline, HighlightStart+"pond"+HighlightStop), true)
+
+	results, _, err = m.Search(context.Background(), `"unbalanced`, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(results), 0)
+}
+
+func TestSnippetModelTimeout(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db, Dialect: SQLite, Timeout: time.Nanosecond}
+
+	_, err := m.Get(context.Background(), 1)
+	assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true)
+}
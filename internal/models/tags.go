@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TagCount - тег и количество активных сниппетов с ним, для облака тегов
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+func insertTags(ctx context.Context, tx *sql.Tx, snippetID int, tags []string) error {
+	// DO UPDATE вместо DO NOTHING, чтобы RETURNING вернул id и для уже существующего тега
+	tagStmt := `INSERT INTO tags (name) VALUES ($1)
+	ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+	RETURNING id`
+	linkStmt := `INSERT INTO snippet_tags (snippet_id, tag_id) VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+	for _, tag := range tags {
+		var tagID int
+		if err := tx.QueryRowContext(ctx, tagStmt, tag).Scan(&tagID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, linkStmt, snippetID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SnippetModel) tags(ctx context.Context, snippetID int) ([]string, error) {
+	stmt := `SELECT t.name FROM tags t JOIN snippet_tags st ON st.tag_id = t.id
+	WHERE st.snippet_id = $1 ORDER BY t.name`
+	rows, err := m.DB.QueryContext(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// ByTag возвращает страницу активных сниппетов с тегом tag
+func (m *SnippetModel) ByTag(ctx context.Context, tag string, cursor Cursor, limit int) (_ *SnippetPage, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	filter := `id IN (SELECT st.snippet_id FROM snippet_tags st
+	JOIN tags t ON t.id = st.tag_id WHERE t.name = $1)`
+	return m.page(ctx, filter, []any{tag}, cursor, limit)
+}
+
+// TagCloud возвращает limit самых популярных тегов среди активных сниппетов
+func (m *SnippetModel) TagCloud(ctx context.Context, limit int) (_ []*TagCount, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT t.name, COUNT(*) AS n FROM tags t
+	JOIN snippet_tags st ON st.tag_id = t.id
+	JOIN snippets s ON s.id = st.snippet_id
+	WHERE s.deleted IS NULL AND s.expires > $1
+	GROUP BY t.name ORDER BY n DESC, t.name LIMIT $2`
+	rows, err := m.DB.QueryContext(ctx, stmt, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cloud := []*TagCount{}
+	for rows.Next() {
+		tc := &TagCount{}
+		if err := rows.Scan(&tc.Name, &tc.Count); err != nil {
+			return nil, err
+		}
+		cloud = append(cloud, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return cloud, nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"snippetbox.glebich/internal/migrate"
+	"snippetbox.glebich/migrations"
+)
+
+// newTestDB создаёт во временном каталоге базу SQLite с применёнными миграциями,
+// поэтому тесты моделей не требуют запущенного Postgres
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, dialect, err := OpenDB("sqlite:" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	fsys, err := migrations.FS(string(dialect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migrate.New(db, string(dialect), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestUser(t *testing.T, db *sql.DB, email string) int {
+	t.Helper()
+
+	users := &UserModel{DB: db}
+	id, err := users.Insert(context.Background(), "Test", email, "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// withTimeout ограничивает ctx таймаутом одного обращения модели к БД
+// (timeout <= 0 - только дедлайн самого ctx). Возвращаемую функцию нужно
+// вызвать через defer с адресом ошибки метода: она отменяет контекст и, если
+// запрос прервался по дедлайну, делает ошибку различимой через
+// errors.Is(err, context.DeadlineExceeded) - pq и sqlite сообщают
+// об отменённом запросе своими ошибками. Исходная ошибка тоже остаётся в цепочке.
+//
+// Заодно на время метода открывается спан с его именем (UserModel.Get)
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, func(*error)) {
+	ctx, end := startSpanSkip(ctx, 1)
+	ctx, done := limitQuery(ctx, timeout)
+	return ctx, func(err *error) {
+		done(err)
+		end(err)
+	}
+}
+
+// limitQuery - withTimeout без спана, для методов, которые открывают спан
+// сами, ещё до медленной подготовки запроса (хеширования пароля)
+func limitQuery(ctx context.Context, timeout time.Duration) (context.Context, func(*error)) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	return ctx, func(err *error) {
+		if *err != nil && ctx.Err() != nil && !errors.Is(*err, ctx.Err()) {
+			*err = fmt.Errorf("%w: %w", ctx.Err(), *err)
+		}
+		cancel()
+	}
+}
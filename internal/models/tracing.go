@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"runtime"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName - имя, под которым модели создают спаны
+const tracerName = "snippetbox.glebich/internal/models"
+
+// startSpan открывает спан с именем метода модели, который её вызвал
+// (UserModel.Get). Возвращаемую функцию нужно вызвать через defer с адресом
+// ошибки метода
+func startSpan(ctx context.Context) (context.Context, func(*error)) {
+	return startSpanSkip(ctx, 1)
+}
+
+// startSpanSkip - startSpan для обёрток: skip - сколько вызовов между
+// методом модели и startSpanSkip, не считая вызова самой startSpanSkip
+func startSpanSkip(ctx context.Context, skip int) (context.Context, func(*error)) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, callerName(skip+1))
+	return ctx, func(err *error) {
+		endSpan(span, *err)
+	}
+}
+
+// endSpan закрывает спан. Ответы вроде "не найдено" или "неверный пароль" -
+// обычный результат, а не сбой, поэтому статус Error они не ставят
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if !errors.Is(err, ErrNoRecord) && !errors.Is(err, ErrWrongCredentials) && !errors.Is(err, ErrDuplicateEntry) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+// callerName возвращает имя функции на skip уровней выше callerName без пути
+// пакета: snippetbox.glebich/internal/models.(*UserModel).Get -> UserModel.Get
+func callerName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "models"
+	}
+	name := runtime.FuncForPC(pc).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimPrefix(name, "models.")
+	return strings.NewReplacer("(*", "", ")", "").Replace(name)
+}
+
+// openTraced открывает БД через драйвер driverName, обёрнутый otelsql: каждый
+// запрос получает свой спан, вложенный в спан метода модели. Методы вроде
+// RefreshTokenModel.Rotate выполняют в транзакции несколько запросов, и без
+// этого было бы не видно, какой из них медленный
+func openTraced(driverName, source string, dialect Dialect) (*sql.DB, error) {
+	system := semconv.DBSystemPostgreSQL
+	if dialect == SQLite {
+		system = semconv.DBSystemSqlite
+	}
+	return otelsql.Open(driverName, source,
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanNameFormatter(func(_ context.Context, method otelsql.Method, query string) string {
+			if operation := sqlOperation(query); operation != "" {
+				return operation
+			}
+			return string(method)
+		}),
+		otelsql.WithAttributesGetter(func(_ context.Context, _ otelsql.Method, query string, _ []driver.NamedValue) []attribute.KeyValue {
+			if operation := sqlOperation(query); operation != "" {
+				return []attribute.KeyValue{semconv.DBOperationName(operation)}
+			}
+			return nil
+		}),
+		// database/sql сам повторяет запрос после driver.ErrSkip, это не ошибка;
+		// спаны на служебные вызовы драйвера только засоряли бы трейс
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitConnectorConnect: true,
+			OmitRows:             true,
+		}),
+	)
+}
+
+// sqlOperation возвращает операцию запроса (SELECT, INSERT...), по ней
+// называется спан. Пусто - вызов без запроса (BEGIN, COMMIT)
+func sqlOperation(query string) string {
+	if fields := strings.Fields(query); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return ""
+}
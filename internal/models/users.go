@@ -1,11 +1,13 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,26 +17,42 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Roles          []string
+	TokenVersion   int
+}
+
+type UserModelInterface interface {
+	Insert(ctx context.Context, name, email, password string) (int, error)
+	Get(ctx context.Context, email, password string) (*User, error)
+	PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) (int, error)
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Timeout time.Duration
 }
 
-func (m *UserModel) Insert(name, email, password string) (int, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (_ int, err error) {
+	ctx, end := startSpan(ctx)
+	defer end(&err)
+
+	// хеширование намеренно медленное, поэтому таймаут запроса начинается после него
+	hashedPassword, err := generateHash(ctx, password)
 	if err != nil {
 		return 0, err
 	}
 
+	ctx, done := limitQuery(ctx, m.Timeout)
+	defer done(&err)
+
 	stmt := `INSERT INTO users(name, email, hashed_password, created)
-	VALUES ($1, $2, $3, CURRENT_TIMESTAMP AT TIME ZONE 'UTC')
+	VALUES ($1, $2, $3, $4)
 	RETURNING id`
 	var id int64
-	err = m.DB.QueryRow(stmt, name, email, hashedPassword).Scan(&id)
+	err = m.DB.QueryRowContext(ctx, stmt, name, email, hashedPassword, time.Now().UTC()).Scan(&id)
 	if err != nil {
 		// нужно, если потом откажусь от отдельной проверки Exist
-		if strings.Contains(err.Error(), "pq: duplicate key value") {
+		if isDuplicate(err) {
 			return 0, ErrDuplicateEntry
 		} else {
 			return 0, err
@@ -64,16 +82,25 @@ func (m *UserModel) Insert(name, email, password string) (int, error) {
 		return true, nil
 	}
 */
-func (m *UserModel) Get(email, password string) (*User, error) {
-	stmt := `SELECT id, name, email, hashed_password FROM users WHERE email = $1`
-	row := m.DB.QueryRow(stmt, email)
+func (m *UserModel) Get(ctx context.Context, email, password string) (_ *User, err error) {
+	ctx, done := withTimeout(ctx, m.Timeout)
+	defer done(&err)
+
+	stmt := `SELECT id, name, email, hashed_password, roles, token_version FROM users WHERE email = $1`
+	row := m.DB.QueryRowContext(ctx, stmt, email)
 
 	u := &User{}
-	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.HashedPassword)
+	var roles string
+	err = row.Scan(&u.ID, &u.Name, &u.Email, &u.HashedPassword, &roles, &u.TokenVersion)
 	if err != nil {
-		return nil, err
+		// неизвестный email - это такие же неверные данные для входа, а не ошибка сервера
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWrongCredentials
+		} else {
+			return nil, err
+		}
 	}
-	err = bcrypt.CompareHashAndPassword(u.HashedPassword, []byte(password))
+	err = compareHash(ctx, u.HashedPassword, password)
 	if err != nil {
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
 			return nil, ErrWrongCredentials
@@ -82,10 +109,76 @@ func (m *UserModel) Get(email, password string) (*User, error) {
 		}
 
 	}
+	u.Roles = strings.Fields(roles)
 	return u, nil
 }
 
-/*
-CREATE TABLE users (id SERIAL NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, email VARCHAR(255) NOT NULL, hashed_password CHAR(60) NOT NULL, created TIMESTAMP NOT NULL);
-ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
-*/
+// PasswordUpdate меняет пароль, если currentPassword верный, и увеличивает
+// версию токенов - все выданные раньше JWT перестают приниматься.
+// Возвращает новую версию
+func (m *UserModel) PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) (_ int, err error) {
+	ctx, end := startSpan(ctx)
+	defer end(&err)
+
+	// как и в Insert, медленное хеширование - вне таймаута запросов,
+	// поэтому у каждого запроса он свой
+	queryCtx, done := limitQuery(ctx, m.Timeout)
+	var currentHash []byte
+	err = m.DB.QueryRowContext(queryCtx, `SELECT hashed_password FROM users WHERE id = $1`, id).Scan(&currentHash)
+	done(&err)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+	err = compareHash(ctx, currentHash, currentPassword)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, ErrWrongCredentials
+		} else {
+			return 0, err
+		}
+	}
+
+	// новый пароль хешируется только после проверки текущего: иначе
+	// неверный текущий пароль стоил бы двух медленных хеширований
+	hashedPassword, err := generateHash(ctx, newPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, done = limitQuery(ctx, m.Timeout)
+	defer done(&err)
+
+	// условие на старый хеш - на случай, если пароль одновременно поменяли в другом запросе
+	stmt := `UPDATE users SET hashed_password = $1, token_version = token_version + 1
+	WHERE id = $2 AND hashed_password = $3
+	RETURNING token_version`
+	var version int
+	err = m.DB.QueryRowContext(ctx, stmt, hashedPassword, id, currentHash).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrWrongCredentials
+		} else {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// bcrypt занимает заметную часть времени входа и регистрации, поэтому
+// у хеширования и проверки пароля свои спаны
+
+func generateHash(ctx context.Context, password string) ([]byte, error) {
+	_, span := otel.Tracer(tracerName).Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+	return bcrypt.GenerateFromPassword([]byte(password), 12)
+}
+
+func compareHash(ctx context.Context, hash []byte, password string) error {
+	_, span := otel.Tracer(tracerName).Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+	return bcrypt.CompareHashAndPassword(hash, []byte(password))
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"snippetbox.glebich/internal/assert"
+)
+
+func TestUserModelSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+
+	id, err := m.Insert(context.Background(), "Alice", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Insert(context.Background(), "Alice again", "alice@example.com", "pa$$word")
+	assert.Equal(t, errors.Is(err, ErrDuplicateEntry), true)
+
+	user, err := m.Get(context.Background(), "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.ID, id)
+
+	_, err = m.Get(context.Background(), "alice@example.com", "wrong")
+	assert.Equal(t, errors.Is(err, ErrWrongCredentials), true)
+}
+
+func TestUserPasswordUpdateSQLite(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	ctx := context.Background()
+
+	id, err := m.Insert(ctx, "Alice", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE users SET roles = 'admin editor' WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := m.Get(ctx, "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.TokenVersion, 1)
+	assert.Equal(t, strings.Join(user.Roles, ","), "admin,editor")
+
+	_, err = m.PasswordUpdate(ctx, id, "wrong", "new-pa$$word")
+	assert.Equal(t, errors.Is(err, ErrWrongCredentials), true)
+
+	version, err := m.PasswordUpdate(ctx, id, "pa$$word", "new-pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, version, 2)
+
+	_, err = m.Get(ctx, "alice@example.com", "pa$$word")
+	assert.Equal(t, errors.Is(err, ErrWrongCredentials), true)
+	user, err = m.Get(ctx, "alice@example.com", "new-pa$$word")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.TokenVersion, 2)
+
+	_, err = m.PasswordUpdate(ctx, id+1, "new-pa$$word", "pa$$word")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestUserSpansSQLite(t *testing.T) {
+	// otelsql берёт провайдер при открытии БД
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	aliceID := newTestUser(t, db, "alice@example.com")
+
+	// спаны закрываются изнутри наружу: запрос, bcrypt, метод
+	spanNames := func(spans []sdktrace.ReadOnlySpan) []string {
+		names := []string{}
+		for _, span := range spans {
+			names = append(names, span.Name())
+		}
+		return names
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		recorder.Reset()
+		_, err := m.Get(context.Background(), "alice@example.com", "wrong")
+		assert.Equal(t, errors.Is(err, ErrWrongCredentials), true)
+
+		spans := recorder.Ended()
+		assert.Equal(t, strings.Join(spanNames(spans), ","), "SELECT,bcrypt.CompareHashAndPassword,UserModel.Get")
+		selectSpan, bcryptSpan, getSpan := spans[0], spans[1], spans[2]
+		assert.Equal(t, selectSpan.Parent().SpanID(), getSpan.SpanContext().SpanID())
+		assert.Equal(t, bcryptSpan.Parent().SpanID(), getSpan.SpanContext().SpanID())
+		assert.Equal(t, hasAttribute(selectSpan, semconv.DBSystemSqlite), true)
+		assert.Equal(t, hasAttribute(selectSpan, semconv.DBOperationName("SELECT")), true)
+		// неверный пароль - не сбой
+		assert.Equal(t, getSpan.Status().Code, codes.Unset)
+		assert.Equal(t, len(getSpan.Events()), 1)
+	})
+
+	t.Run("Insert", func(t *testing.T) {
+		recorder.Reset()
+		_, err := m.Insert(context.Background(), "Bob", "bob@example.com", "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		spans := recorder.Ended()
+		assert.Equal(t, strings.Join(spanNames(spans), ","), "bcrypt.GenerateFromPassword,INSERT,UserModel.Insert")
+		// хеширование тоже внутри спана метода, хотя таймаут запроса начинается после него
+		insertSpan := spans[2]
+		assert.Equal(t, spans[0].Parent().SpanID(), insertSpan.SpanContext().SpanID())
+		assert.Equal(t, spans[1].Parent().SpanID(), insertSpan.SpanContext().SpanID())
+	})
+
+	t.Run("Password update with wrong password", func(t *testing.T) {
+		recorder.Reset()
+		_, err := m.PasswordUpdate(context.Background(), aliceID, "wrong", "new-pa$$word")
+		assert.Equal(t, errors.Is(err, ErrWrongCredentials), true)
+
+		// новый пароль не хешируется, пока не проверен текущий
+		spans := recorder.Ended()
+		assert.Equal(t, strings.Join(spanNames(spans), ","), "SELECT,bcrypt.CompareHashAndPassword,UserModel.PasswordUpdate")
+	})
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, want attribute.KeyValue) bool {
+	for _, attr := range span.Attributes() {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
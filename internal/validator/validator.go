@@ -10,6 +10,10 @@ import (
 
 var regexpName = regexp.MustCompile("^[A-Za-z0-9]+([A-Za-z0-9]*|[._-]?[A-Za-z0-9]+)*$")
 
+// буквы любого алфавита, цифры и символы, которые встречаются в названиях
+// технологий: c++, c#, node.js, ci-cd
+var regexpTag = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}+#._-]*$`)
+
 type Validator struct {
 	FieldErrors map[string]string
 }
@@ -55,6 +59,14 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	//return slices.Contains(permittedValues, value)
 }
 
+func MaxItems[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
+func ValidTag(tag string) bool {
+	return regexpTag.MatchString(tag)
+}
+
 func ValidEmail(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
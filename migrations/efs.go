@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// миграции для каждой СУБД лежат в своём каталоге: postgres, sqlite
+//
+//go:embed "postgres" "sqlite"
+var Files embed.FS
+
+// FS возвращает миграции для СУБД dialect
+func FS(dialect string) (fs.FS, error) {
+	return fs.Sub(Files, dialect)
+}
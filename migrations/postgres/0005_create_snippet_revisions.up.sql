@@ -0,0 +1,17 @@
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS snippet_revisions (
+    id SERIAL NOT NULL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    FOREIGN KEY (snippet_id) REFERENCES snippets(id),
+    UNIQUE (snippet_id, revision)
+);
+
+-- для уже существующих сниппетов первая ревизия создаётся из текущего текста
+INSERT INTO snippet_revisions (snippet_id, revision, title, content, created)
+SELECT id, revision, title, content, created FROM snippets
+ON CONFLICT (snippet_id, revision) DO NOTHING;
@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS deleted TIMESTAMP;
@@ -0,0 +1,6 @@
+-- словарь simple, потому что сниппеты пишут и на русском, и на английском
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', content), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_search ON snippets USING GIN (search);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_expires;
+DROP INDEX IF EXISTS idx_snippets_deleted;
+DROP INDEX IF EXISTS idx_snippets_expires;
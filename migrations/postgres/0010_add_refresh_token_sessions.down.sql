@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_value;
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+
+-- раньше у пользователя была одна сессия, остаётся самая новая
+DELETE FROM refresh_tokens t
+WHERE EXISTS (SELECT 1 FROM refresh_tokens n WHERE n.user_id = t.user_id AND n.id > t.id);
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN last_used,
+    DROP COLUMN created,
+    DROP COLUMN ip,
+    DROP COLUMN user_agent;
+
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_user_id_key UNIQUE (user_id);
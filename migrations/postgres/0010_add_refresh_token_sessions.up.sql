@@ -0,0 +1,14 @@
+-- у пользователя может быть несколько сессий, по одной на устройство
+ALTER TABLE refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_user_id_key;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN created TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc'),
+    ADD COLUMN last_used TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+
+-- время для новых строк задаёт приложение
+ALTER TABLE refresh_tokens ALTER COLUMN created DROP DEFAULT, ALTER COLUMN last_used DROP DEFAULT;
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE UNIQUE INDEX idx_refresh_tokens_value ON refresh_tokens(value);
@@ -0,0 +1,6 @@
+-- по хешу токен не восстановить, сессии завершаются и при откате
+DELETE FROM refresh_tokens;
+
+ALTER INDEX idx_refresh_tokens_hash RENAME TO idx_refresh_tokens_value;
+ALTER TABLE refresh_tokens ALTER COLUMN hash TYPE CHAR(60);
+ALTER TABLE refresh_tokens RENAME COLUMN hash TO value;
@@ -0,0 +1,7 @@
+-- в таблице хранится только SHA-256 refresh токена. Старые токены хранились
+-- открытым текстом, их хеши взять неоткуда, поэтому все сессии завершаются
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens RENAME COLUMN value TO hash;
+ALTER TABLE refresh_tokens ALTER COLUMN hash TYPE CHAR(64);
+ALTER INDEX idx_refresh_tokens_value RENAME TO idx_refresh_tokens_hash;
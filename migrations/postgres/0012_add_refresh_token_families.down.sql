@@ -0,0 +1,7 @@
+DELETE FROM refresh_tokens WHERE rotated IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_family_id;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN rotated,
+    DROP COLUMN family_id;
@@ -0,0 +1,12 @@
+-- при каждом обмене refresh токен заменяется новым. Все токены одной сессии
+-- образуют семейство (family_id - id первого токена), заменённые токены
+-- остаются с отметкой rotated, чтобы заметить их повторное использование
+ALTER TABLE refresh_tokens
+    ADD COLUMN family_id INTEGER,
+    ADD COLUMN rotated TIMESTAMP;
+
+UPDATE refresh_tokens SET family_id = id;
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP COLUMN token_version,
+    DROP COLUMN roles;
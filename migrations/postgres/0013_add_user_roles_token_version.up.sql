@@ -0,0 +1,6 @@
+-- roles - роли пользователя через пробел (например, 'admin'), попадают в JWT.
+-- token_version увеличивается при смене пароля, и выданные раньше JWT
+-- перестают приниматься
+ALTER TABLE users
+    ADD COLUMN roles VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN token_version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN access_expires,
+    DROP COLUMN access_jti;
+
+DROP TABLE revoked_tokens;
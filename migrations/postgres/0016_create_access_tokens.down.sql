@@ -0,0 +1,5 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN access_jti VARCHAR(64),
+    ADD COLUMN access_expires TIMESTAMP;
+
+DROP TABLE access_tokens;
@@ -0,0 +1,22 @@
+-- access токены (JWT), выданные сессиям. У сессии их бывает несколько:
+-- пока действует RotationGrace, параллельные запросы со старым refresh
+-- токеном получают каждый свой JWT. При завершении сессии отзываются все.
+-- Строка нужна, пока токен не истёк сам, после этого её удаляет Reaper
+CREATE TABLE access_tokens (
+    jti VARCHAR(64) NOT NULL PRIMARY KEY,
+    family_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    expires TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_access_tokens_family_id ON access_tokens(family_id);
+CREATE INDEX idx_access_tokens_user_id ON access_tokens(user_id);
+CREATE INDEX idx_access_tokens_expires ON access_tokens(expires);
+
+INSERT INTO access_tokens(jti, family_id, user_id, expires)
+SELECT access_jti, family_id, user_id, access_expires FROM refresh_tokens
+WHERE access_jti IS NOT NULL AND access_expires IS NOT NULL;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN access_jti,
+    DROP COLUMN access_expires;
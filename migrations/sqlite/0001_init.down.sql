@@ -0,0 +1,13 @@
+DROP TABLE snippets_fts;
+
+DROP TABLE snippet_tags;
+
+DROP TABLE tags;
+
+DROP TABLE snippet_revisions;
+
+DROP TABLE refresh_tokens;
+
+DROP TABLE snippets;
+
+DROP TABLE users;
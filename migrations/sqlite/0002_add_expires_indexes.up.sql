@@ -0,0 +1,4 @@
+-- фоновая очистка ищет истекшие записи по expires и удалённые по deleted
+CREATE INDEX IF NOT EXISTS idx_snippets_expires ON snippets(expires);
+CREATE INDEX IF NOT EXISTS idx_snippets_deleted ON snippets(deleted);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires);
@@ -0,0 +1,17 @@
+CREATE TABLE refresh_tokens_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    value CHAR(60) NOT NULL,
+    expires TIMESTAMP NOT NULL,
+    user_id INTEGER NOT NULL UNIQUE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- раньше у пользователя была одна сессия, остаётся самая новая
+INSERT INTO refresh_tokens_old (id, value, expires, user_id)
+SELECT id, value, expires, user_id FROM refresh_tokens t
+WHERE NOT EXISTS (SELECT 1 FROM refresh_tokens n WHERE n.user_id = t.user_id AND n.id > t.id);
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_old RENAME TO refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens_expires ON refresh_tokens(expires);
@@ -0,0 +1,23 @@
+-- у пользователя может быть несколько сессий, по одной на устройство.
+-- SQLite не умеет удалять ограничения, поэтому таблица пересоздаётся
+CREATE TABLE refresh_tokens_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    value CHAR(60) NOT NULL,
+    expires TIMESTAMP NOT NULL,
+    user_id INTEGER NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL,
+    last_used TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+INSERT INTO refresh_tokens_new (id, value, expires, user_id, created, last_used)
+SELECT id, value, expires, user_id, datetime('now'), datetime('now') FROM refresh_tokens;
+
+DROP TABLE refresh_tokens;
+ALTER TABLE refresh_tokens_new RENAME TO refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens_expires ON refresh_tokens(expires);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE UNIQUE INDEX idx_refresh_tokens_value ON refresh_tokens(value);
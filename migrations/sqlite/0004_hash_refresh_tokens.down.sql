@@ -0,0 +1,6 @@
+-- по хешу токен не восстановить, сессии завершаются и при откате
+DELETE FROM refresh_tokens;
+
+DROP INDEX idx_refresh_tokens_hash;
+ALTER TABLE refresh_tokens RENAME COLUMN hash TO value;
+CREATE UNIQUE INDEX idx_refresh_tokens_value ON refresh_tokens(value);
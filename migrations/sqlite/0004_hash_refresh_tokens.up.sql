@@ -0,0 +1,7 @@
+-- в таблице хранится только SHA-256 refresh токена. Старые токены хранились
+-- открытым текстом, их хеши взять неоткуда, поэтому все сессии завершаются
+DELETE FROM refresh_tokens;
+
+DROP INDEX idx_refresh_tokens_value;
+ALTER TABLE refresh_tokens RENAME COLUMN value TO hash;
+CREATE UNIQUE INDEX idx_refresh_tokens_hash ON refresh_tokens(hash);
@@ -0,0 +1,6 @@
+DELETE FROM refresh_tokens WHERE rotated IS NOT NULL;
+
+DROP INDEX idx_refresh_tokens_family_id;
+
+ALTER TABLE refresh_tokens DROP COLUMN rotated;
+ALTER TABLE refresh_tokens DROP COLUMN family_id;
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens DROP COLUMN access_expires;
+ALTER TABLE refresh_tokens DROP COLUMN access_jti;
+
+DROP TABLE revoked_tokens;
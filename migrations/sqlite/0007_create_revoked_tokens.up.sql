@@ -0,0 +1,16 @@
+-- отозванные до истечения access токены (JWT) по их jti. Строка нужна,
+-- пока токен не истёк сам, после этого её удаляет Reaper
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(64) NOT NULL PRIMARY KEY,
+    user_id INTEGER,
+    expires TIMESTAMP NOT NULL,
+    revoked TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_revoked_tokens_expires ON revoked_tokens(expires);
+CREATE INDEX idx_revoked_tokens_revoked ON revoked_tokens(revoked);
+
+-- последний access токен, выданный сессии, - чтобы при завершении
+-- сессии отозвать и его
+ALTER TABLE refresh_tokens ADD COLUMN access_jti VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN access_expires TIMESTAMP;
@@ -0,0 +1,13 @@
+-- версии токенов пользователей, сменивших пароль: JWT с меньшей версией
+-- не принимаются. Экземпляры приложения загружают их вместе с отозванными
+-- токенами, чтобы не читать users на каждый запрос. Строка нужна, пока
+-- не истекли JWT со старой версией, после этого её удаляет Reaper
+CREATE TABLE token_versions (
+    user_id INTEGER NOT NULL PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    expires TIMESTAMP NOT NULL,
+    changed TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_token_versions_expires ON token_versions(expires);
+CREATE INDEX idx_token_versions_changed ON token_versions(changed);